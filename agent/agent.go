@@ -0,0 +1,46 @@
+// Package agent serves decrypted groups to local processes over a Unix
+// socket, so that the key and the backend connection can live in one
+// long-running process rather than in every command that needs them.
+//
+// Clients send one JSON request per line and receive JSON responses in the
+// same way. A get request is answered with the group's values. A watch
+// request is answered once the watch is in place, with Watching set, and then
+// each time the group changes, until the connection is closed.
+package agent
+
+import (
+	"fmt"
+)
+
+// A Source provides the decrypted values of groups, and reports when they
+// change. The Client is itself a Source.
+type Source interface {
+	GetGroup(group string) (map[string]string, error)
+	WatchGroup(group string, changes chan<- string, started chan<- struct{}, stop <-chan bool) error
+}
+
+const (
+	OpGet   = "get"
+	OpWatch = "watch"
+)
+
+type Request struct {
+	Op    string
+	Group string
+}
+
+type Response struct {
+	Env      map[string]string `json:",omitempty"`
+	Watching bool              `json:",omitempty"`
+	Changed  string            `json:",omitempty"`
+	Error    string            `json:",omitempty"`
+}
+
+// AgentError is an error reported by the agent.
+type AgentError struct {
+	Message string
+}
+
+func (e AgentError) Error() string {
+	return fmt.Sprintf("agent: %s", e.Message)
+}
@@ -0,0 +1,376 @@
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSource serves groups from a map, counting fetches, and reports a
+// change whenever one is sent on its changes channel. If ready is not nil,
+// watches aren't in place until it is closed.
+type testSource struct {
+	mu      sync.Mutex
+	groups  map[string]map[string]string
+	fetches int
+	changes chan string
+	ready   chan struct{}
+}
+
+func newTestSource(groups map[string]map[string]string) *testSource {
+	return &testSource{groups: groups, changes: make(chan string)}
+}
+
+func (s *testSource) GetGroup(group string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fetches++
+	env := make(map[string]string)
+	for variable, value := range s.groups[group] {
+		env[variable] = value
+	}
+	return env, nil
+}
+
+func (s *testSource) WatchGroup(group string, changes chan<- string, started chan<- struct{}, stop <-chan bool) error {
+	if s.ready != nil {
+		select {
+		case <-stop:
+			return nil
+		case <-s.ready:
+		}
+	}
+	close(started)
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case changed := <-s.changes:
+			if changed == group {
+				changes <- group
+			}
+		}
+	}
+}
+
+func (s *testSource) set(group, variable, value string) {
+	s.mu.Lock()
+	s.groups[group][variable] = value
+	s.mu.Unlock()
+
+	s.changes <- group
+}
+
+func (s *testSource) fetchCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches
+}
+
+func startServer(t *testing.T, server *Server) (*Client, func()) {
+	dir, err := ioutil.TempDir("", "context-agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "agent.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	go server.Serve(l)
+
+	return NewClient(path), func() {
+		l.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func currentPolicy() *Policy {
+	return &Policy{Uids: []int{os.Getuid()}}
+}
+
+// waitStarted waits for the server's watch of group to be in place.
+func waitStarted(t *testing.T, server *Server, group string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		server.mu.Lock()
+		state, ok := server.groups[group]
+		var started chan struct{}
+		if ok {
+			started = state.started
+		}
+		server.mu.Unlock()
+
+		if started != nil {
+			select {
+			case <-started:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		} else {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the watch of %s to start!", group)
+		}
+	}
+}
+
+// watchedGroups returns the number of groups the server is watching.
+func watchedGroups(server *Server) int {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return len(server.groups)
+}
+
+func TestGetGroup(t *testing.T) {
+	source := newTestSource(map[string]map[string]string{
+		"default": {"A": "1"},
+	})
+
+	server := NewServer(source, currentPolicy())
+	server.Groups = []string{"default"}
+	client, stop := startServer(t, server)
+	defer stop()
+
+	if _, err := client.GetGroup("default"); err != nil {
+		t.Fatal(err)
+	}
+	waitStarted(t, server, "default")
+
+	// Once the watch is in place, the group is fetched once more and then
+	// served from the cache.
+	fetches := source.fetchCount()
+	for i := 0; i < 3; i++ {
+		env, err := client.GetGroup("default")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := map[string]string{"A": "1"}; !reflect.DeepEqual(env, expected) {
+			t.Errorf("expected %v but found %v!", expected, env)
+		}
+	}
+
+	if fetched := source.fetchCount() - fetches; fetched != 1 {
+		t.Errorf("expected the group to be fetched once but it was fetched %d times!", fetched)
+	}
+
+	// A change drops the cached values.
+	source.set("default", "A", "2")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		env, err := client.GetGroup("default")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if env["A"] == "2" {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the change to be served but found %v!", env)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGetGroupWatchStart(t *testing.T) {
+	source := newTestSource(map[string]map[string]string{
+		"default": {"A": "1"},
+	})
+	source.ready = make(chan struct{})
+
+	server := NewServer(source, currentPolicy())
+	server.Groups = []string{"default"}
+	client, stop := startServer(t, server)
+	defer stop()
+
+	if _, err := client.GetGroup("default"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Until the watch is in place a change could go unreported, so nothing
+	// is cached.
+	source.mu.Lock()
+	source.groups["default"]["A"] = "2"
+	source.mu.Unlock()
+
+	env, err := client.GetGroup("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if env["A"] != "2" {
+		t.Errorf("expected the change to be served but found %v!", env)
+	}
+
+	close(source.ready)
+	waitStarted(t, server, "default")
+
+	fetches := source.fetchCount()
+	for i := 0; i < 3; i++ {
+		if _, err := client.GetGroup("default"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if fetched := source.fetchCount() - fetches; fetched != 1 {
+		t.Errorf("expected the group to be fetched once but it was fetched %d times!", fetched)
+	}
+}
+
+func TestGetGroupUnlisted(t *testing.T) {
+	source := newTestSource(map[string]map[string]string{
+		"default": {"A": "1"},
+	})
+
+	server := NewServer(source, currentPolicy())
+	client, stop := startServer(t, server)
+	defer stop()
+
+	// Without a list of groups, any name may be asked for, so nothing is
+	// cached or watched for a get.
+	for i := 0; i < 3; i++ {
+		if _, err := client.GetGroup(fmt.Sprintf("group%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if fetches := source.fetchCount(); fetches != 3 {
+		t.Errorf("expected 3 fetches but found %d!", fetches)
+	}
+
+	if watched := watchedGroups(server); watched != 0 {
+		t.Errorf("expected no groups to be watched but found %d!", watched)
+	}
+}
+
+func TestWatchGroup(t *testing.T) {
+	source := newTestSource(map[string]map[string]string{
+		"default": {"A": "1"},
+		"other":   {"B": "1"},
+	})
+
+	server := NewServer(source, currentPolicy())
+	client, stop := startServer(t, server)
+	defer stop()
+
+	changes := make(chan string)
+	started := make(chan struct{})
+	stopWatch := make(chan bool)
+	errs := make(chan error, 1)
+	go func() { errs <- client.WatchGroup("default", changes, started, stopWatch) }()
+
+	select {
+	case <-started:
+	case err := <-errs:
+		t.Fatalf("expected the watch to start but found %v!", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the watch to start!")
+	}
+
+	// Once the watch has started, a single change must be reported, and
+	// changes to other groups must not be.
+	source.set("other", "B", "2")
+	source.set("default", "A", "2")
+
+	select {
+	case group := <-changes:
+		if group != "default" {
+			t.Errorf("expected a change to default but found %s!", group)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a change to be reported!")
+	}
+
+	close(stopWatch)
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the watch to stop!")
+	}
+
+	// The group is no longer watched once its last watcher has gone.
+	deadline := time.Now().Add(5 * time.Second)
+	for watchedGroups(server) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the group to stop being watched!")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	source := newTestSource(map[string]map[string]string{
+		"default": {"A": "1"},
+	})
+
+	client, stop := startServer(t, NewServer(source, &Policy{Uids: []int{os.Getuid() + 1}}))
+	defer stop()
+
+	if _, err := client.GetGroup("default"); err == nil {
+		t.Error("expected a peer outside the policy to be refused!")
+	} else if _, ok := err.(AgentError); !ok {
+		t.Errorf("expected an AgentError but found %v!", err)
+	}
+
+	if source.fetchCount() != 0 {
+		t.Error("expected a refused peer not to reach the source!")
+	}
+
+	if !(&Policy{Gids: []int{7}}).Allow(&Credentials{Uid: 1, Gid: 7}) {
+		t.Error("expected a listed group to be allowed!")
+	}
+}
+
+func TestAllowedGroups(t *testing.T) {
+	source := newTestSource(map[string]map[string]string{
+		"default": {"A": "1"},
+		"private": {"B": "1"},
+	})
+
+	server := NewServer(source, currentPolicy())
+	server.Groups = []string{"default"}
+	client, stop := startServer(t, server)
+	defer stop()
+
+	if _, err := client.GetGroup("default"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := client.GetGroup("private"); err == nil {
+		t.Error("expected a group that isn't served to be refused!")
+	}
+}
+
+func TestParseIds(t *testing.T) {
+	ids, err := ParseIds("0, 1000,,33")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []int{0, 1000, 33}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected %v but found %v!", expected, ids)
+	}
+
+	if _, err := ParseIds("root"); err == nil {
+		t.Error("expected an error for a non-numeric id!")
+	}
+}
@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+)
+
+// A Client talks to an agent over its socket.
+type Client struct {
+	Path string
+}
+
+func NewClient(path string) *Client {
+	return &Client{Path: path}
+}
+
+func (c *Client) dial(request Request) (net.Conn, *json.Decoder, error) {
+	conn, err := net.Dial("unix", c.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := json.NewEncoder(conn).Encode(request); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	return conn, json.NewDecoder(bufio.NewReader(conn)), nil
+}
+
+// GetGroup returns the decrypted values of a group.
+func (c *Client) GetGroup(group string) (map[string]string, error) {
+	conn, decoder, err := c.dial(Request{Op: OpGet, Group: group})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var response Response
+	if err := decoder.Decode(&response); err != nil {
+		return nil, err
+	}
+
+	if response.Error != "" {
+		return nil, AgentError{response.Error}
+	}
+
+	if response.Env == nil {
+		response.Env = make(map[string]string)
+	}
+
+	return response.Env, nil
+}
+
+// WatchGroup sends the group's name on changes each time the agent reports
+// that it changed, until stop is closed. It closes started, unless it is nil,
+// once the agent reports that its watch is in place.
+func (c *Client) WatchGroup(group string, changes chan<- string, started chan<- struct{}, stop <-chan bool) error {
+	conn, decoder, err := c.dial(Request{Op: OpWatch, Group: group})
+	if err != nil {
+		return err
+	}
+
+	// Closing the connection ends the pending read below.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+		case <-done:
+		}
+		conn.Close()
+	}()
+
+	for {
+		var response Response
+		if err := decoder.Decode(&response); err != nil {
+			select {
+			case <-stop:
+				return nil
+			default:
+				return err
+			}
+		}
+
+		if response.Error != "" {
+			return AgentError{response.Error}
+		}
+
+		if response.Watching {
+			if started != nil {
+				close(started)
+			}
+			continue
+		}
+
+		select {
+		case changes <- response.Changed:
+		case <-stop:
+			return nil
+		}
+	}
+}
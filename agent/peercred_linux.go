@@ -0,0 +1,28 @@
+package agent
+
+import (
+	"net"
+	"syscall"
+)
+
+// peerCredentials asks the kernel who is on the other end of conn.
+func peerCredentials(conn *net.UnixConn) (*Credentials, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var ucred *syscall.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		ucred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return nil, err
+	}
+
+	if credErr != nil {
+		return nil, credErr
+	}
+
+	return &Credentials{Pid: int(ucred.Pid), Uid: int(ucred.Uid), Gid: int(ucred.Gid)}, nil
+}
@@ -0,0 +1,14 @@
+// +build !linux
+
+package agent
+
+import (
+	"errors"
+	"net"
+)
+
+// peerCredentials is only implemented on Linux. Elsewhere every connection
+// is refused rather than served without knowing who made it.
+func peerCredentials(conn *net.UnixConn) (*Credentials, error) {
+	return nil, errors.New("peer credentials are not supported on this platform")
+}
@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Credentials identify the process on the other end of a connection, as
+// reported by the kernel.
+type Credentials struct {
+	Pid, Uid, Gid int
+}
+
+// A Policy lists the users and groups allowed to connect. A peer is allowed
+// if its user or its primary group is listed.
+type Policy struct {
+	Uids, Gids []int
+}
+
+func (p *Policy) Allow(cred *Credentials) bool {
+	for _, uid := range p.Uids {
+		if cred.Uid == uid {
+			return true
+		}
+	}
+
+	for _, gid := range p.Gids {
+		if cred.Gid == gid {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseIds reads a comma-separated list of numeric ids.
+func ParseIds(s string) ([]int, error) {
+	var ids []int
+	for _, field := range strings.Split(s, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+
+		id, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,336 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// WatchRetryDelay is how long the server waits before watching a group again
+// after its watch failed.
+var WatchRetryDelay = 5 * time.Second
+
+// groupState is what the server knows about a watched group. env is nil when
+// the group isn't cached, generation counts changes, and subscribers are woken
+// whenever it changes. started is closed once the current watch is in place,
+// and values are only cached after that, since until then a change could be
+// missed.
+type groupState struct {
+	env         map[string]string
+	generation  int
+	subscribers map[chan struct{}]bool
+	started     chan struct{}
+
+	// Groups listed in Server.Groups are watched for as long as the server
+	// runs. Others are watched only while they have subscribers, and
+	// evicting them stops the watch.
+	pinned  bool
+	evicted chan struct{}
+}
+
+// A Server answers requests from a Source. Groups listed in Groups are cached
+// until a watch reports that they changed. Other groups are only watched, and
+// cached, while a client watches them, so that requests for arbitrary names
+// can't build up watches without bound.
+type Server struct {
+	Source Source
+	Policy *Policy
+
+	// Groups, if not empty, lists the only groups that may be requested.
+	Groups []string
+
+	mu     sync.Mutex
+	groups map[string]*groupState
+	stop   chan bool
+}
+
+func NewServer(source Source, policy *Policy) *Server {
+	return &Server{
+		Source: source,
+		Policy: policy,
+		groups: make(map[string]*groupState),
+		stop:   make(chan bool),
+	}
+}
+
+// Serve accepts connections on l until it is closed, then stops watching.
+func (s *Server) Serve(l net.Listener) error {
+	defer close(s.stop)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) allowedGroup(group string) bool {
+	if len(s.Groups) == 0 {
+		return true
+	}
+
+	for _, allowed := range s.Groups {
+		if group == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	encoder := json.NewEncoder(conn)
+
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		encoder.Encode(Response{Error: "not a unix socket"})
+		return
+	}
+
+	cred, err := peerCredentials(unixConn)
+	if err != nil {
+		encoder.Encode(Response{Error: err.Error()})
+		return
+	}
+
+	if !s.Policy.Allow(cred) {
+		fmt.Fprintf(os.Stderr, "refused pid %d, uid %d, gid %d\n", cred.Pid, cred.Uid, cred.Gid)
+		encoder.Encode(Response{Error: "permission denied"})
+		return
+	}
+
+	decoder := json.NewDecoder(conn)
+	for {
+		var request Request
+		if err := decoder.Decode(&request); err != nil {
+			if err != io.EOF {
+				encoder.Encode(Response{Error: err.Error()})
+			}
+			return
+		}
+
+		if !s.allowedGroup(request.Group) {
+			encoder.Encode(Response{Error: fmt.Sprintf("group \"%s\" is not served", request.Group)})
+			continue
+		}
+
+		switch request.Op {
+		case OpGet:
+			env, err := s.getGroup(request.Group)
+			if err != nil {
+				encoder.Encode(Response{Error: err.Error()})
+				continue
+			}
+			encoder.Encode(Response{Env: env})
+		case OpWatch:
+
+			// A watch takes over the connection until the client closes it.
+			s.watchGroup(conn, encoder, request.Group)
+			return
+		default:
+			encoder.Encode(Response{Error: fmt.Sprintf("unknown op \"%s\"", request.Op)})
+		}
+	}
+}
+
+// state returns the state of a group, creating it and starting its watch as
+// needed. It must be called with the server locked.
+func (s *Server) state(group string) *groupState {
+	if state, ok := s.groups[group]; ok {
+		return state
+	}
+
+	state := &groupState{
+		subscribers: make(map[chan struct{}]bool),
+		started:     make(chan struct{}),
+		pinned:      len(s.Groups) > 0,
+		evicted:     make(chan struct{}),
+	}
+	s.groups[group] = state
+
+	// The watch ends when the server stops or the group is evicted.
+	stop := make(chan bool)
+	go func() {
+		select {
+		case <-s.stop:
+		case <-state.evicted:
+		}
+		close(stop)
+	}()
+
+	go s.watch(group, state, stop)
+	return state
+}
+
+// evict stops watching a group once nothing needs it. It must be called with
+// the server locked.
+func (s *Server) evict(group string, state *groupState) {
+	if state.pinned || len(state.subscribers) > 0 || s.groups[group] != state {
+		return
+	}
+
+	delete(s.groups, group)
+	close(state.evicted)
+}
+
+// getGroup returns a group from the cache, fetching it on a miss. Groups that
+// aren't cached or watched are fetched every time.
+func (s *Server) getGroup(group string) (map[string]string, error) {
+	s.mu.Lock()
+	state, ok := s.groups[group]
+	if !ok && len(s.Groups) > 0 {
+		state = s.state(group)
+	}
+
+	if state == nil {
+		s.mu.Unlock()
+		return s.Source.GetGroup(group)
+	}
+
+	env, generation := state.env, state.generation
+	var started bool
+	select {
+	case <-state.started:
+		started = true
+	default:
+	}
+	s.mu.Unlock()
+
+	if env != nil {
+		return env, nil
+	}
+
+	env, err := s.Source.GetGroup(group)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only cache the values if the watch was in place before they were
+	// fetched and hasn't reported a change since, as they may be out of date
+	// otherwise.
+	s.mu.Lock()
+	if started && state.generation == generation {
+		state.env = env
+	}
+	s.mu.Unlock()
+
+	return env, nil
+}
+
+// watch keeps the cache of a group honest, dropping it whenever the group
+// changes. If the watch fails the cache is dropped as well, since changes
+// could be missed, and the watch is retried until stop is closed.
+func (s *Server) watch(group string, state *groupState, stop <-chan bool) {
+	for {
+		s.mu.Lock()
+		started := state.started
+		s.mu.Unlock()
+
+		changes := make(chan string)
+		errs := make(chan error, 1)
+		go func() { errs <- s.Source.WatchGroup(group, changes, started, stop) }()
+
+	loop:
+		for {
+			select {
+			case <-changes:
+				s.invalidate(state)
+			case err := <-errs:
+				if err == nil {
+					return
+				}
+
+				fmt.Fprintf(os.Stderr, "%s: %s\n", group, err)
+				s.mu.Lock()
+				state.started = make(chan struct{})
+				s.mu.Unlock()
+				s.invalidate(state)
+				break loop
+			}
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(WatchRetryDelay):
+		}
+	}
+}
+
+// invalidate drops a group from the cache and tells its subscribers that it
+// changed.
+func (s *Server) invalidate(state *groupState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state.env = nil
+	state.generation++
+	for subscriber := range state.subscribers {
+		select {
+		case subscriber <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// watchGroup reports changes to a group on the connection until the client
+// closes it, first telling the client once the watch is in place.
+func (s *Server) watchGroup(conn net.Conn, encoder *json.Encoder, group string) {
+	subscriber := make(chan struct{}, 1)
+
+	s.mu.Lock()
+	state := s.state(group)
+	state.subscribers[subscriber] = true
+	started := state.started
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(state.subscribers, subscriber)
+		s.evict(group, state)
+		s.mu.Unlock()
+	}()
+
+	// Clients send nothing more, so a read only returns once the connection
+	// is closed.
+	closed := make(chan struct{})
+	go func() {
+		io.Copy(ioutil.Discard, conn)
+		close(closed)
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-s.stop:
+			return
+		case <-started:
+			started = nil
+			if err := encoder.Encode(Response{Watching: true}); err != nil {
+				return
+			}
+		case <-subscriber:
+			if err := encoder.Encode(Response{Changed: group}); err != nil {
+				return
+			}
+
+			// A watch that failed before it was in place is replaced by one
+			// with a new started channel.
+			if started != nil {
+				s.mu.Lock()
+				started = state.started
+				s.mu.Unlock()
+			}
+		}
+	}
+}
@@ -2,7 +2,10 @@ package backend
 
 import (
 	"fmt"
-	"strings"
+	"net/http"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/garyburd/redigo/redis"
 )
 
 type Backend interface {
@@ -11,17 +14,47 @@ type Backend interface {
 	RemoveVariable(group, variable string) error
 	GetGroup(group string) (map[string][]byte, error)
 	RemoveGroup(group string) error
+	ListGroups() ([]string, error)
+
+	// Namespace returns the namespace that values are stored under, which a
+	// backend URI may set in place of the one given.
+	Namespace() string
+
+	// WatchGroup sends the group's name on changes whenever a variable in it
+	// may have changed, until stop is closed. It closes started, unless it is
+	// nil, once the watch is in place, after which no change is missed. It
+	// blocks until stop is closed, returning nil, or until the watch fails.
+	WatchGroup(group string, changes chan<- string, started chan<- struct{}, stop <-chan bool) error
 }
 
+// NewBackend returns a backend of the given kind. The address may also be a
+// URI, whose scheme then selects the backend whatever the kind:
+//
+//	redis://[[user]:password@]host[:port][/database][?options]
+//	rediss://...                  Redis over TLS
+//	etcd://host1[:port],host2...  etcd over HTTP, as is etcd+http://
+//	etcd+https://...              etcd over TLS
+//
+// The options are namespace, which replaces the given namespace, password
+// for Redis, and ca, cert and key, the paths of a CA certificate to verify
+// the server with and of a client certificate and its key, for TLS.
 func NewBackend(kind, namespace, address string) (Backend, error) {
+	if scheme := uriScheme(address); scheme != "" {
+		kind = uriKinds[scheme]
+	}
 
 	// Select a backend based on kind.
 	switch kind {
 	case "etcd":
-		backend := NewEtcdBackend(namespace, strings.Split(address, ","))
-		return backend, nil
+		return newEtcdBackendFromAddress(namespace, address)
 	case "redis":
-		backend := NewRedisBackend(namespace, address)
+		return newRedisBackendFromAddress(namespace, address)
+	case "consul":
+		return newConsulBackendFromAddress(namespace, address)
+	case "file":
+		return newFileBackendFromAddress(namespace, address)
+	case "memory":
+		backend := newSharedMemoryBackend(namespace, address)
 		return backend, nil
 	}
 
@@ -36,3 +69,26 @@ type NoBackendError struct {
 func (e NoBackendError) Error() string {
 	return fmt.Sprintf("backend: backend \"%s\" has not been implemented", e.Kind)
 }
+
+type NoVariableError struct {
+	Group, Variable string
+}
+
+func (e NoVariableError) Error() string {
+	return fmt.Sprintf("backend: variable \"%s\" is not set in group \"%s\"", e.Variable, e.Group)
+}
+
+// IsNotFound reports whether err means that a variable or group doesn't
+// exist, which each backend reports in its own way.
+func IsNotFound(err error) bool {
+	switch err := err.(type) {
+	case NoVariableError:
+		return true
+	case *etcd.EtcdError:
+		return err.ErrorCode == 100
+	case ConsulError:
+		return err.StatusCode == http.StatusNotFound
+	}
+
+	return err == redis.ErrNil
+}
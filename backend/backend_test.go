@@ -1,114 +1,95 @@
-package backend
+package backend_test
 
 import (
-	"bytes"
+	"fmt"
+	"os"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/newsdev/context/backend"
+	"github.com/newsdev/context/backend/backendtest"
 )
 
-var testBackends = []struct {
-	Kind, Namespace, Address string
-}{
-	{"redis", "redistest", ":6379"},
-	{"etcd", "etcdtest", "http://127.0.0.1:4001"},
-}
+var testNamespaceCount int64
 
-func backendPairs() map[string][]byte {
-	testBackendsPairs := make(map[string][]byte)
-	testBackendsPairs["TESTVARIABLE1"] = []byte("test value #1")
-	testBackendsPairs["TESTVARIABLE2"] = []byte("test value #2")
-	testBackendsPairs["TESTVARIABLE3"] = []byte("test value #3")
-	return testBackendsPairs
+// testNamespace returns a namespace that is unique to this process and call,
+// so that tests against shared services don't see each other's groups.
+func testNamespace(prefix string) string {
+	n := atomic.AddInt64(&testNamespaceCount, 1)
+	return fmt.Sprintf("%s%d%d", prefix, time.Now().UnixNano(), n)
 }
 
-func TestBackend(t *testing.T) {
-	testBackendsPairs := backendPairs()
-	for _, b := range testBackends {
-
-		backend, err := NewBackend(b.Kind, b.Namespace, b.Address)
+// serviceFactory returns a factory for a backend that talks to a running
+// service, removing the groups the suite uses once each test is done.
+func serviceFactory(kind, address string) backendtest.Factory {
+	return func(t *testing.T) backend.Backend {
+		b, err := backend.NewBackend(kind, testNamespace(kind+"test"), address)
 		if err != nil {
 			t.Fatal(err)
 		}
 
-		for variable, value := range testBackendsPairs {
-
-			if err := backend.SetVariable("testgroup", variable, value); err != nil {
-				t.Fatal(err)
-			}
-		}
-
-		for variable, value := range testBackendsPairs {
-			v, err := backend.GetVariable("testgroup", variable)
-			if err != nil {
-				t.Error(err)
-			} else if !bytes.Equal(v, value) {
-				t.Errorf("expected value %s for %s but found %s!", value, variable, v)
-			}
-
-			if err := backend.RemoveVariable("testgroup", variable); err != nil {
-				t.Error(err)
-			}
-
-			g, err := backend.GetGroup("testgroup")
-			if err != nil {
-				t.Error(err)
+		t.Cleanup(func() {
+			for _, group := range []string{"testgroup", "testgroupother"} {
+				b.RemoveGroup(group)
 			}
-			if _, ok := g[variable]; ok {
-				t.Errorf("removed variable %s is still present!", variable)
-			}
-		}
-
-		if err := backend.RemoveGroup("testgroup"); err != nil {
-			t.Fatal(err)
-		}
+		})
 
+		return b
 	}
 }
 
-func TestBackendGetAll(t *testing.T) {
-	testBackendsPairs := backendPairs()
-	for _, b := range testBackends {
-
-		backend, err := NewBackend(b.Kind, b.Namespace, b.Address)
-		if err != nil {
-			t.Fatal(err)
-		}
+func TestMemoryBackend(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) backend.Backend {
+		return backend.NewMemoryBackend("memorytest")
+	})
+}
 
-		for variable, value := range testBackendsPairs {
-			if err := backend.SetVariable("testgroup", variable, value); err != nil {
-				t.Fatal(err)
-			}
-		}
+func TestMemoryBackendShared(t *testing.T) {
+	b1, err := backend.NewBackend("memory", "memorytest", "TestMemoryBackendShared")
+	if err != nil {
+		t.Fatal(err)
+	}
 
-		variables, err := backend.GetGroup("testgroup")
-		if err != nil {
-			t.Fatal(err)
-		}
+	b2, err := backend.NewBackend("memory", "memorytest", "TestMemoryBackendShared")
+	if err != nil {
+		t.Fatal(err)
+	}
 
-		for variable, value := range testBackendsPairs {
-			v, ok := variables[variable]
-			if !ok {
-				t.Errorf("no value returned for %s!", variable)
-			} else if !bytes.Equal(v, value) {
-				t.Errorf("expected value \"%s\" for %s but found \"%s\"!", value, variable, v)
-			}
-		}
+	if err := b1.SetVariable("testgroup", "TESTVARIABLE", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
 
-		if err := backend.RemoveGroup("testgroup"); err != nil {
-			t.Fatal(err)
-		}
+	if v, err := b2.GetVariable("testgroup", "TESTVARIABLE"); err != nil {
+		t.Error(err)
+	} else if string(v) != "value" {
+		t.Errorf("expected value \"value\" but found %q!", v)
 	}
 }
 
-func TestBackendGetEmptyGroup(t *testing.T) {
-	for _, b := range testBackends {
-		backend, err := NewBackend(b.Kind, b.Namespace, b.Address)
-		if err != nil {
-			t.Fatal(err)
-		}
+// The Redis and etcd suites need running services, and are skipped unless an
+// address is given in the environment.
+func TestRedisBackend(t *testing.T) {
+	address := os.Getenv("CONTEXT_TEST_REDIS_ADDRESS")
+	if address == "" {
+		t.Skip("CONTEXT_TEST_REDIS_ADDRESS is not set")
+	}
 
-		if _, err := backend.GetGroup("testgroup"); err != nil {
-			t.Fatal(err)
-		}
+	backendtest.Run(t, serviceFactory("redis", address))
+}
 
+func TestEtcdBackend(t *testing.T) {
+	address := os.Getenv("CONTEXT_TEST_ETCD_ADDRESS")
+	if address == "" {
+		t.Skip("CONTEXT_TEST_ETCD_ADDRESS is not set")
 	}
+
+	backendtest.Run(t, serviceFactory("etcd", address))
+}
+
+func TestMain(m *testing.M) {
+
+	// Poll quickly so that the watch tests for polling backends are fast.
+	backend.WatchPollInterval = 50 * time.Millisecond
+	os.Exit(m.Run())
 }
@@ -0,0 +1,249 @@
+// Package backendtest provides a conformance suite that every Backend
+// implementation is expected to pass.
+package backendtest
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/newsdev/context/backend"
+)
+
+// A Factory returns a new Backend for a single test. Backends returned by
+// separate calls must not share any groups, and the factory should register
+// any cleanup it needs with t.Cleanup.
+type Factory func(t *testing.T) backend.Backend
+
+func pairs() map[string][]byte {
+	return map[string][]byte{
+		"TESTVARIABLE1": []byte("test value #1"),
+		"TESTVARIABLE2": []byte("test value #2"),
+		"TESTVARIABLE3": []byte("test value #3"),
+	}
+}
+
+// Run runs the full conformance suite against backends built by factory.
+func Run(t *testing.T, factory Factory) {
+	t.Run("SetGetRemove", func(t *testing.T) { testSetGetRemove(t, factory(t)) })
+	t.Run("GetGroup", func(t *testing.T) { testGetGroup(t, factory(t)) })
+	t.Run("EmptyGroup", func(t *testing.T) { testEmptyGroup(t, factory(t)) })
+	t.Run("RemoveGroup", func(t *testing.T) { testRemoveGroup(t, factory(t)) })
+	t.Run("Overwrite", func(t *testing.T) { testOverwrite(t, factory(t)) })
+	t.Run("BinarySafe", func(t *testing.T) { testBinarySafe(t, factory(t)) })
+	t.Run("EmptyString", func(t *testing.T) { testEmptyString(t, factory(t)) })
+	t.Run("MissingVariable", func(t *testing.T) { testMissingVariable(t, factory(t)) })
+	t.Run("GroupIsolation", func(t *testing.T) { testGroupIsolation(t, factory(t)) })
+	t.Run("ListGroups", func(t *testing.T) { testListGroups(t, factory(t)) })
+	t.Run("WatchGroup", func(t *testing.T) { testWatchGroup(t, factory(t)) })
+}
+
+func set(t *testing.T, b backend.Backend, group string, variables map[string][]byte) {
+	for variable, value := range variables {
+		if err := b.SetVariable(group, variable, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func expectGroup(t *testing.T, b backend.Backend, group string, expected map[string][]byte) {
+	variables, err := b.GetGroup(group)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(variables) != len(expected) {
+		t.Errorf("expected %d variables in %s but found %d!", len(expected), group, len(variables))
+	}
+
+	for variable, value := range expected {
+		if v, ok := variables[variable]; !ok {
+			t.Errorf("no value returned for %s!", variable)
+		} else if !bytes.Equal(v, value) {
+			t.Errorf("expected value %q for %s but found %q!", value, variable, v)
+		}
+	}
+}
+
+func expectVariable(t *testing.T, b backend.Backend, group, variable string, expected []byte) {
+	v, err := b.GetVariable(group, variable)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(v, expected) {
+		t.Errorf("expected value %q for %s but found %q!", expected, variable, v)
+	}
+}
+
+func testSetGetRemove(t *testing.T, b backend.Backend) {
+	testPairs := pairs()
+	set(t, b, "testgroup", testPairs)
+
+	for variable, value := range testPairs {
+		expectVariable(t, b, "testgroup", variable, value)
+
+		if err := b.RemoveVariable("testgroup", variable); err != nil {
+			t.Error(err)
+		}
+
+		g, err := b.GetGroup("testgroup")
+		if err != nil {
+			t.Error(err)
+		}
+		if _, ok := g[variable]; ok {
+			t.Errorf("removed variable %s is still present!", variable)
+		}
+	}
+}
+
+func testGetGroup(t *testing.T, b backend.Backend) {
+	testPairs := pairs()
+	set(t, b, "testgroup", testPairs)
+	expectGroup(t, b, "testgroup", testPairs)
+}
+
+func testEmptyGroup(t *testing.T, b backend.Backend) {
+	expectGroup(t, b, "testgroup", map[string][]byte{})
+}
+
+func testRemoveGroup(t *testing.T, b backend.Backend) {
+	set(t, b, "testgroup", pairs())
+
+	if err := b.RemoveGroup("testgroup"); err != nil {
+		t.Fatal(err)
+	}
+
+	expectGroup(t, b, "testgroup", map[string][]byte{})
+}
+
+func testOverwrite(t *testing.T, b backend.Backend) {
+	set(t, b, "testgroup", map[string][]byte{"TESTVARIABLE": []byte("a much longer first value")})
+	set(t, b, "testgroup", map[string][]byte{"TESTVARIABLE": []byte("second")})
+	expectVariable(t, b, "testgroup", "TESTVARIABLE", []byte("second"))
+}
+
+func testBinarySafe(t *testing.T, b backend.Backend) {
+	value := make([]byte, 256)
+	for i := range value {
+		value[i] = byte(i)
+	}
+
+	// Trailing NUL bytes are a common casualty of string handling.
+	value = append(value, 0, 0)
+
+	set(t, b, "testgroup", map[string][]byte{"TESTBINARY": value})
+	expectVariable(t, b, "testgroup", "TESTBINARY", value)
+	expectGroup(t, b, "testgroup", map[string][]byte{"TESTBINARY": value})
+}
+
+func testEmptyString(t *testing.T, b backend.Backend) {
+	set(t, b, "testgroup", map[string][]byte{"TESTEMPTY": []byte{}})
+	expectVariable(t, b, "testgroup", "TESTEMPTY", []byte{})
+	expectGroup(t, b, "testgroup", map[string][]byte{"TESTEMPTY": []byte{}})
+}
+
+func testMissingVariable(t *testing.T, b backend.Backend) {
+	if _, err := b.GetVariable("testgroup", "TESTMISSING"); err == nil {
+		t.Error("expected an error for a variable in a missing group!")
+	} else if !backend.IsNotFound(err) {
+		t.Errorf("expected a missing variable to be reported as not found but found %v!", err)
+	}
+
+	set(t, b, "testgroup", pairs())
+
+	if _, err := b.GetVariable("testgroup", "TESTMISSING"); err == nil {
+		t.Error("expected an error for a missing variable!")
+	} else if !backend.IsNotFound(err) {
+		t.Errorf("expected a missing variable to be reported as not found but found %v!", err)
+	}
+}
+
+func testGroupIsolation(t *testing.T, b backend.Backend) {
+	testPairs := pairs()
+	other := map[string][]byte{"TESTVARIABLE1": []byte("other value")}
+
+	// Groups sharing a prefix must not leak into each other.
+	set(t, b, "testgroup", testPairs)
+	set(t, b, "testgroupother", other)
+
+	expectGroup(t, b, "testgroup", testPairs)
+	expectGroup(t, b, "testgroupother", other)
+
+	if err := b.RemoveGroup("testgroup"); err != nil {
+		t.Fatal(err)
+	}
+
+	expectGroup(t, b, "testgroupother", other)
+}
+
+func expectGroups(t *testing.T, b backend.Backend, expected []string) {
+	groups, err := b.ListGroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(groups) != 0 || len(expected) != 0 {
+		if !reflect.DeepEqual(groups, expected) {
+			t.Errorf("expected groups %q but found %q!", expected, groups)
+		}
+	}
+}
+
+func testListGroups(t *testing.T, b backend.Backend) {
+	expectGroups(t, b, []string{})
+
+	set(t, b, "testgroupother", pairs())
+	set(t, b, "testgroup", pairs())
+	expectGroups(t, b, []string{"testgroup", "testgroupother"})
+
+	if err := b.RemoveGroup("testgroupother"); err != nil {
+		t.Fatal(err)
+	}
+	expectGroups(t, b, []string{"testgroup"})
+}
+
+// WatchTimeout is how long the suite waits for a watch to report a change.
+// It must allow for backends that poll.
+var WatchTimeout = 10 * time.Second
+
+func testWatchGroup(t *testing.T, b backend.Backend) {
+	changes := make(chan string)
+	started := make(chan struct{})
+	stop := make(chan bool)
+	errs := make(chan error, 1)
+	go func() { errs <- b.WatchGroup("testgroup", changes, started, stop) }()
+
+	select {
+	case <-started:
+	case err := <-errs:
+		t.Fatalf("expected the watch to start but found %v!", err)
+	case <-time.After(WatchTimeout):
+		t.Fatal("expected the watch to start!")
+	}
+
+	// Once the watch has started, a single write must be reported.
+	if err := b.SetVariable("testgroup", "TESTVARIABLE", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case group := <-changes:
+		if group != "testgroup" {
+			t.Errorf("expected a change to \"testgroup\" but found %q!", group)
+		}
+	case err := <-errs:
+		t.Fatalf("expected the watch to run until stopped but found %v!", err)
+	case <-time.After(WatchTimeout):
+		t.Fatal("expected a change to be reported!")
+	}
+
+	close(stop)
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(WatchTimeout):
+		t.Error("expected the watch to stop!")
+	}
+}
@@ -0,0 +1,343 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	ConsulDefaultAddress = "http://127.0.0.1:8500"
+	ConsulTokenHeader    = "X-Consul-Token"
+	ConsulIndexHeader    = "X-Consul-Index"
+
+	// ConsulWatchWait is how long each blocking query made by WatchGroup may
+	// wait for a change before Consul answers anyway.
+	ConsulWatchWait = "5m"
+)
+
+type ConsulBackend struct {
+	namespace, address, token, datacenter string
+	client                                *http.Client
+}
+
+// consulPair is the subset of a Consul KV entry that we care about. Consul
+// base64-encodes values in its JSON responses, which the standard decoder
+// handles for []byte fields.
+type consulPair struct {
+	Key   string
+	Value []byte
+}
+
+func NewConsulBackend(namespace, address, token, datacenter string) *ConsulBackend {
+	if address == "" {
+		address = ConsulDefaultAddress
+	} else if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+
+	return &ConsulBackend{
+		namespace:  namespace,
+		address:    strings.TrimRight(address, "/"),
+		token:      token,
+		datacenter: datacenter,
+		client:     &http.Client{},
+	}
+}
+
+// newConsulBackendFromAddress builds a Consul backend from an address of the
+// form http://host:port?token=secret&dc=dc1.
+func newConsulBackendFromAddress(namespace, address string) (*ConsulBackend, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+
+	query := u.Query()
+	u.RawQuery = ""
+	return NewConsulBackend(namespace, u.String(), query.Get("token"), query.Get("dc")), nil
+}
+
+func (c *ConsulBackend) keyGroup(group string) string {
+	return key(c.namespace, group) + KeySeperator
+}
+
+func (c *ConsulBackend) keyVariable(group, variable string) string {
+	return key(c.namespace, group, variable)
+}
+
+// newRequest builds a request against the KV endpoint for the given key.
+func (c *ConsulBackend) newRequest(method, key string, query url.Values, body []byte) (*http.Request, error) {
+	if query == nil {
+		query = make(url.Values)
+	}
+	if c.datacenter != "" {
+		query.Set("dc", c.datacenter)
+	}
+
+	u, err := url.Parse(c.address)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + "/v1/kv/" + key
+	u.RawQuery = query.Encode()
+
+	request, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	if c.token != "" {
+		request.Header.Set(ConsulTokenHeader, c.token)
+	}
+
+	return request, nil
+}
+
+// do performs a request against the KV endpoint for the given key. A nil
+// response is returned along with a nil error if the key does not exist.
+func (c *ConsulBackend) do(method, key string, query url.Values, body []byte) (*http.Response, error) {
+	request, err := c.newRequest(method, key, query, body)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode == http.StatusNotFound {
+		response.Body.Close()
+		return nil, nil
+	}
+
+	if response.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		return nil, ConsulError{response.StatusCode, strings.TrimSpace(string(message))}
+	}
+
+	return response, nil
+}
+
+func (c *ConsulBackend) getPairs(key string, query url.Values) ([]consulPair, error) {
+	response, err := c.do("GET", key, query, nil)
+	if err != nil || response == nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var pairs []consulPair
+	if err := json.NewDecoder(response.Body).Decode(&pairs); err != nil {
+		return nil, err
+	}
+
+	return pairs, nil
+}
+
+func (c *ConsulBackend) Namespace() string {
+	return c.namespace
+}
+
+func (c *ConsulBackend) GetVariable(group, variable string) ([]byte, error) {
+	pairs, err := c.getPairs(c.keyVariable(group, variable), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pairs) == 0 {
+		return nil, NoVariableError{group, variable}
+	}
+
+	// Consul returns null rather than an empty string for empty values.
+	if pairs[0].Value == nil {
+		return []byte{}, nil
+	}
+
+	return pairs[0].Value, nil
+}
+
+func (c *ConsulBackend) SetVariable(group, variable string, value []byte) error {
+	response, err := c.do("PUT", c.keyVariable(group, variable), nil, value)
+	if err != nil {
+		return err
+	}
+	if response == nil {
+		return ConsulError{http.StatusNotFound, "key could not be written"}
+	}
+	defer response.Body.Close()
+
+	// Consul reports the success of the write in the response body.
+	var ok bool
+	if err := json.NewDecoder(response.Body).Decode(&ok); err != nil {
+		return err
+	}
+	if !ok {
+		return ConsulError{response.StatusCode, "key could not be written"}
+	}
+
+	return nil
+}
+
+func (c *ConsulBackend) RemoveVariable(group, variable string) error {
+	response, err := c.do("DELETE", c.keyVariable(group, variable), nil, nil)
+	if err != nil || response == nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+func (c *ConsulBackend) GetGroup(group string) (map[string][]byte, error) {
+	prefix := c.keyGroup(group)
+	pairs, err := c.getPairs(prefix, url.Values{"recurse": []string{""}})
+	if err != nil {
+		return nil, err
+	}
+
+	groupMap := make(map[string][]byte)
+	for _, pair := range pairs {
+		variable := strings.TrimPrefix(pair.Key, prefix)
+
+		// Skip the group key itself as well as anything nested further down.
+		if variable == "" || strings.Contains(variable, KeySeperator) {
+			continue
+		}
+
+		if pair.Value == nil {
+			pair.Value = []byte{}
+		}
+		groupMap[variable] = pair.Value
+	}
+
+	return groupMap, nil
+}
+
+func (c *ConsulBackend) RemoveGroup(group string) error {
+	response, err := c.do("DELETE", c.keyGroup(group), url.Values{"recurse": []string{""}}, nil)
+	if err != nil || response == nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+func (c *ConsulBackend) ListGroups() ([]string, error) {
+	prefix := c.namespace + KeySeperator
+
+	// List only the keys one level below the namespace. Groups show up as
+	// keys ending in the separator.
+	response, err := c.do("GET", prefix, url.Values{"keys": []string{""}, "separator": []string{KeySeperator}}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]string, 0)
+	if response == nil {
+		return groups, nil
+	}
+	defer response.Body.Close()
+
+	var keys []string
+	if err := json.NewDecoder(response.Body).Decode(&keys); err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		if strings.HasSuffix(key, KeySeperator) {
+			groups = append(groups, strings.TrimSuffix(strings.TrimPrefix(key, prefix), KeySeperator))
+		}
+	}
+
+	sort.Strings(groups)
+	return groups, nil
+}
+
+// WatchGroup makes blocking queries on the group's prefix, each of which
+// returns once the prefix's index moves past the last one seen.
+func (c *ConsulBackend) WatchGroup(group string, changes chan<- string, started chan<- struct{}, stop <-chan bool) error {
+
+	// Cancel any request in flight once stop is closed.
+	cancel := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+			close(cancel)
+		case <-done:
+		}
+	}()
+
+	var index uint64
+	for {
+		query := url.Values{"recurse": []string{""}}
+		if index > 0 {
+			query.Set("index", strconv.FormatUint(index, 10))
+			query.Set("wait", ConsulWatchWait)
+		}
+
+		request, err := c.newRequest("GET", c.keyGroup(group), query, nil)
+		if err != nil {
+			return err
+		}
+		request.Cancel = cancel
+
+		response, err := c.client.Do(request)
+		if err != nil {
+			select {
+			case <-stop:
+				return nil
+			default:
+				return err
+			}
+		}
+
+		// Only the index matters, but a missing prefix still has one.
+		message, err := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNotFound {
+			return ConsulError{response.StatusCode, strings.TrimSpace(string(message))}
+		}
+
+		next, err := strconv.ParseUint(response.Header.Get(ConsulIndexHeader), 10, 64)
+		if err != nil {
+			return ConsulError{response.StatusCode, "missing or invalid " + ConsulIndexHeader}
+		}
+
+		// The index only moves forward, unless Consul's state was restored, in
+		// which case it's treated as a change as well. Once the first index is
+		// known, the next query reports any change made since.
+		if index == 0 {
+			closeStarted(started)
+		} else if next != index {
+			if !notify(group, changes, stop) {
+				return nil
+			}
+		}
+
+		index = next
+		if index == 0 {
+			index = 1
+		}
+	}
+}
+
+// ConsulError represents an unexpected response from the Consul HTTP API.
+type ConsulError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e ConsulError) Error() string {
+	return fmt.Sprintf("consul: unexpected status %d: %s", e.StatusCode, e.Message)
+}
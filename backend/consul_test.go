@@ -0,0 +1,236 @@
+package backend_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/newsdev/context/backend"
+	"github.com/newsdev/context/backend/backendtest"
+)
+
+const (
+	testConsulToken      = "test-token"
+	testConsulDatacenter = "dc2"
+)
+
+type fakeConsulPair struct {
+	Key   string
+	Value []byte
+}
+
+// fakeConsul implements enough of the Consul KV HTTP API to exercise the
+// Consul backend without a running agent.
+type fakeConsul struct {
+	mu   sync.Mutex
+	data map[string][]byte
+
+	// index counts writes, and changed is closed and replaced on each one, to
+	// support blocking queries.
+	index   uint64
+	changed chan struct{}
+}
+
+func newFakeConsul() *httptest.Server {
+	return httptest.NewServer(&fakeConsul{
+		data:    make(map[string][]byte),
+		index:   1,
+		changed: make(chan struct{}),
+	})
+}
+
+func (f *fakeConsul) write() {
+	f.index++
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// block waits, with the lock released, until a write moves the index past
+// the one the client last saw. Waits are kept short so that the server can
+// be closed promptly.
+func (f *fakeConsul) block(r *http.Request) {
+	index, err := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+	if err != nil || index != f.index {
+		return
+	}
+
+	changed := f.changed
+	f.mu.Unlock()
+	select {
+	case <-changed:
+	case <-r.Context().Done():
+	case <-time.After(time.Second):
+	}
+	f.mu.Lock()
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get(backend.ConsulTokenHeader) != testConsulToken {
+		http.Error(w, "ACL not found", http.StatusForbidden)
+		return
+	}
+
+	if r.URL.Query().Get("dc") != testConsulDatacenter {
+		http.Error(w, "No path to datacenter", http.StatusInternalServerError)
+		return
+	}
+
+	if !strings.HasPrefix(r.URL.Path, "/v1/kv/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	_, recurse := r.URL.Query()["recurse"]
+
+	switch r.Method {
+	case "GET":
+		f.block(r)
+		w.Header().Set(backend.ConsulIndexHeader, strconv.FormatUint(f.index, 10))
+
+		if _, ok := r.URL.Query()["keys"]; ok {
+			f.listKeys(w, r, key)
+			return
+		}
+
+		keys := make([]string, 0)
+		for k := range f.data {
+			if k == key || (recurse && strings.HasPrefix(k, key)) {
+				keys = append(keys, k)
+			}
+		}
+
+		if len(keys) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+
+		sort.Strings(keys)
+		pairs := make([]fakeConsulPair, 0, len(keys))
+		for _, k := range keys {
+			pairs = append(pairs, fakeConsulPair{Key: k, Value: f.data[k]})
+		}
+		json.NewEncoder(w).Encode(pairs)
+
+	case "PUT":
+		value, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Consul stores empty bodies as null values.
+		if len(value) == 0 {
+			value = nil
+		}
+		f.data[key] = value
+		f.write()
+		w.Write([]byte("true"))
+
+	case "DELETE":
+		for k := range f.data {
+			if k == key || (recurse && strings.HasPrefix(k, key)) {
+				delete(f.data, k)
+			}
+		}
+		f.write()
+		w.Write([]byte("true"))
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// listKeys lists the keys under prefix, truncating each after the first
+// separator that follows the prefix.
+func (f *fakeConsul) listKeys(w http.ResponseWriter, r *http.Request, prefix string) {
+	separator := r.URL.Query().Get("separator")
+
+	seen := make(map[string]bool)
+	keys := make([]string, 0)
+	for k := range f.data {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+
+		if separator != "" {
+			if i := strings.Index(k[len(prefix):], separator); i >= 0 {
+				k = k[:len(prefix)+i+len(separator)]
+			}
+		}
+
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+
+	if len(keys) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	sort.Strings(keys)
+	json.NewEncoder(w).Encode(keys)
+}
+
+func testConsulAddress(server *httptest.Server) string {
+	return server.URL + "?token=" + testConsulToken + "&dc=" + testConsulDatacenter
+}
+
+func TestConsulBackend(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) backend.Backend {
+		server := newFakeConsul()
+		t.Cleanup(server.Close)
+
+		b, err := backend.NewBackend("consul", "consultest", testConsulAddress(server))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return b
+	})
+}
+
+func TestConsulBackendMissingVariable(t *testing.T) {
+	server := newFakeConsul()
+	defer server.Close()
+
+	b, err := backend.NewBackend("consul", "consultest", testConsulAddress(server))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.GetVariable("testgroup", "TESTVARIABLE1"); err == nil {
+		t.Error("expected an error for a missing variable!")
+	} else if _, ok := err.(backend.NoVariableError); !ok {
+		t.Errorf("expected a NoVariableError but found %T!", err)
+	}
+}
+
+func TestConsulBackendACL(t *testing.T) {
+	server := newFakeConsul()
+	defer server.Close()
+
+	b, err := backend.NewBackend("consul", "consultest", server.URL+"?token=wrong&dc="+testConsulDatacenter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = b.SetVariable("testgroup", "TESTVARIABLE1", []byte("value"))
+	if consulErr, ok := err.(backend.ConsulError); !ok {
+		t.Errorf("expected a ConsulError but found %v!", err)
+	} else if consulErr.StatusCode != http.StatusForbidden {
+		t.Errorf("expected status %d but found %d!", http.StatusForbidden, consulErr.StatusCode)
+	}
+}
@@ -3,9 +3,14 @@ package backend
 import (
 	"encoding/base64"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
 	"strings"
+	"time"
 
-	"github.com/newsdev/context/vendor/src/github.com/coreos/go-etcd/etcd"
+	"github.com/coreos/go-etcd/etcd"
 )
 
 const (
@@ -24,6 +29,64 @@ func NewEtcdBackend(namespace string, machines []string) *EtcdBackend {
 	}
 }
 
+// newEtcdBackendFromAddress builds an etcd backend from a comma-separated
+// list of machines, or from an etcd URI listing them as its host.
+func newEtcdBackendFromAddress(namespace, address string) (*EtcdBackend, error) {
+	scheme := uriScheme(address)
+	if scheme == "" {
+		return NewEtcdBackend(namespace, strings.Split(address, ",")), nil
+	}
+
+	// The host holds several machines, which url.Parse won't accept.
+	rest := address[len(scheme)+len("://"):]
+	var rawQuery string
+	if i := strings.IndexByte(rest, '?'); i >= 0 {
+		rest, rawQuery = rest[:i], rest[i+1:]
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, URIError{err.Error()}
+	}
+
+	if n := query.Get("namespace"); n != "" {
+		namespace = n
+	}
+
+	machineScheme := "http"
+	if scheme == "etcd+https" {
+		machineScheme = "https"
+	} else if err := checkNoTLS(scheme, query); err != nil {
+		return nil, err
+	}
+
+	var machines []string
+	for _, host := range strings.Split(strings.TrimSuffix(rest, "/"), ",") {
+		if host == "" {
+			return nil, URIError{"empty etcd host"}
+		}
+		machines = append(machines, machineScheme+"://"+host)
+	}
+
+	e := NewEtcdBackend(namespace, machines)
+	if machineScheme == "https" {
+
+		// go-etcd's own TLS client doesn't verify the server, so use a
+		// transport that does.
+		config, err := tlsConfig(query)
+		if err != nil {
+			return nil, err
+		}
+
+		e.client.SetTransport(&http.Transport{
+			Dial:            (&net.Dialer{Timeout: time.Second}).Dial,
+			TLSClientConfig: config,
+		})
+	}
+
+	return e, nil
+}
+
 func key(components ...string) string {
 	return strings.Join(components, KeySeperator)
 }
@@ -36,6 +99,10 @@ func (e *EtcdBackend) keyVariable(group, variable string) string {
 	return key(e.namespace, group, variable)
 }
 
+func (e *EtcdBackend) Namespace() string {
+	return e.namespace
+}
+
 func (e *EtcdBackend) GetVariable(group, variable string) ([]byte, error) {
 	response, err := e.client.Get(e.keyVariable(group, variable), false, false)
 	if err != nil {
@@ -69,6 +136,7 @@ func (e *EtcdBackend) GetGroup(group string) (map[string][]byte, error) {
 		if etcdErr, ok := err.(*etcd.EtcdError); ok && etcdErr.ErrorCode == 100 {
 			return make(map[string][]byte), nil
 		}
+		return nil, err
 	}
 
 	prefix := fmt.Sprintf("/%s/", key)
@@ -88,3 +156,81 @@ func (e *EtcdBackend) RemoveGroup(group string) error {
 	_, err := e.client.Delete(e.keyGroup(group), true)
 	return err
 }
+
+func (e *EtcdBackend) ListGroups() ([]string, error) {
+	response, err := e.client.Get(e.namespace, true, false)
+
+	// A missing namespace directory has no groups.
+	if err != nil {
+		if etcdErr, ok := err.(*etcd.EtcdError); ok && etcdErr.ErrorCode == 100 {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+
+	prefix := fmt.Sprintf("/%s/", e.namespace)
+	groups := make([]string, 0, len(response.Node.Nodes))
+	for _, node := range response.Node.Nodes {
+		if node.Dir {
+			groups = append(groups, strings.TrimPrefix(node.Key, prefix))
+		}
+	}
+
+	sort.Strings(groups)
+	return groups, nil
+}
+
+// WatchGroup uses a recursive etcd watch on the group's directory, starting
+// just after the current index so that no change made once it is in place is
+// missed.
+func (e *EtcdBackend) WatchGroup(group string, changes chan<- string, started chan<- struct{}, stop <-chan bool) error {
+	key := e.keyGroup(group)
+
+	// A missing group still reports the current index with its error.
+	var index uint64
+	response, err := e.client.Get(key, false, false)
+	if err == nil {
+		index = response.EtcdIndex
+	} else if etcdErr, ok := err.(*etcd.EtcdError); ok && etcdErr.ErrorCode == 100 {
+		index = etcdErr.Index
+	} else {
+		return err
+	}
+	closeStarted(started)
+
+	receiver := make(chan *etcd.Response)
+	etcdStop := make(chan bool)
+	errs := make(chan error, 1)
+	go func() {
+		_, err := e.client.Watch(key, index+1, true, receiver, etcdStop)
+		errs <- err
+	}()
+
+	// Watch closes the receiver when it returns, so draining it ensures that
+	// the watch isn't left blocked on a send.
+	shutdown := func() error {
+		close(etcdStop)
+		for _ = range receiver {
+		}
+
+		if err := <-errs; err != etcd.ErrWatchStoppedByUser {
+			return err
+		}
+		return nil
+	}
+
+	for {
+		select {
+		case <-stop:
+			return shutdown()
+		case _, ok := <-receiver:
+			if !ok {
+				return <-errs
+			}
+
+			if !notify(group, changes, stop) {
+				return shutdown()
+			}
+		}
+	}
+}
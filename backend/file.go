@@ -0,0 +1,299 @@
+package backend
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+const (
+	FileLockName   = ".lock"
+	FileTempPrefix = ".tmp-"
+)
+
+// A FileBackend stores each variable as a file at root/namespace/group/variable.
+// Writes are atomic, and a lock file in the namespace directory serializes
+// writers across processes.
+type FileBackend struct {
+	namespace, root string
+}
+
+func NewFileBackend(namespace, root string) *FileBackend {
+	return &FileBackend{
+		namespace: namespace,
+		root:      strings.TrimPrefix(root, "file://"),
+	}
+}
+
+// newFileBackendFromAddress accepts a directory path or a file:// URI. Any
+// other URI, such as the default address of another backend, is an error
+// rather than a relative path.
+func newFileBackendFromAddress(namespace, address string) (*FileBackend, error) {
+	root := strings.TrimPrefix(address, "file://")
+	if root == "" || strings.Contains(root, "://") {
+		return nil, FileAddressError{address}
+	}
+
+	return NewFileBackend(namespace, root), nil
+}
+
+// checkName rejects names that can't be used safely as a single path
+// component. Names beginning with a dot are reserved for the lock file and
+// for temporary files.
+func checkName(name string) error {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, "/\x00") {
+		return fmt.Errorf("file: invalid name \"%s\"", name)
+	}
+	return nil
+}
+
+func (f *FileBackend) pathNamespace() string {
+	return filepath.Join(f.root, f.namespace)
+}
+
+func (f *FileBackend) pathGroup(group string) (string, error) {
+	if err := checkName(group); err != nil {
+		return "", err
+	}
+	return filepath.Join(f.pathNamespace(), group), nil
+}
+
+func (f *FileBackend) pathVariable(group, variable string) (string, error) {
+	if err := checkName(variable); err != nil {
+		return "", err
+	}
+
+	groupPath, err := f.pathGroup(group)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(groupPath, variable), nil
+}
+
+// lock takes a lock of the given type (syscall.LOCK_SH or syscall.LOCK_EX) on
+// the namespace and returns the file that must be closed to release it.
+func (f *FileBackend) lock(how int) (*os.File, error) {
+	if err := os.MkdirAll(f.pathNamespace(), 0700); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(filepath.Join(f.pathNamespace(), FileLockName), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(file.Fd()), how); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func (f *FileBackend) Namespace() string {
+	return f.namespace
+}
+
+func (f *FileBackend) GetVariable(group, variable string) ([]byte, error) {
+	path, err := f.pathVariable(group, variable)
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := f.lock(syscall.LOCK_SH)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Close()
+
+	value, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, NoVariableError{group, variable}
+	}
+
+	return value, err
+}
+
+func (f *FileBackend) SetVariable(group, variable string, value []byte) error {
+	path, err := f.pathVariable(group, variable)
+	if err != nil {
+		return err
+	}
+
+	lock, err := f.lock(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	groupPath := filepath.Dir(path)
+	if err := os.MkdirAll(groupPath, 0700); err != nil {
+		return err
+	}
+
+	// Write the value to a temporary file in the same directory so that it
+	// can be renamed into place, replacing any existing value atomically.
+	temp, err := ioutil.TempFile(groupPath, FileTempPrefix)
+	if err != nil {
+		return err
+	}
+
+	if _, err := temp.Write(value); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return err
+	}
+
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return err
+	}
+
+	if err := temp.Close(); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+
+	if err := os.Rename(temp.Name(), path); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+
+	return syncDir(groupPath)
+}
+
+func (f *FileBackend) RemoveVariable(group, variable string) error {
+	path, err := f.pathVariable(group, variable)
+	if err != nil {
+		return err
+	}
+
+	lock, err := f.lock(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// Drop the group directory once it is empty, the same way a Redis hash
+	// disappears with its last field. This fails harmlessly otherwise.
+	os.Remove(filepath.Dir(path))
+
+	return nil
+}
+
+func (f *FileBackend) GetGroup(group string) (map[string][]byte, error) {
+	groupPath, err := f.pathGroup(group)
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := f.lock(syscall.LOCK_SH)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Close()
+
+	groupMap := make(map[string][]byte)
+
+	infos, err := ioutil.ReadDir(groupPath)
+	if os.IsNotExist(err) {
+		return groupMap, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, info := range infos {
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+
+		value, err := ioutil.ReadFile(filepath.Join(groupPath, info.Name()))
+		if err != nil {
+			return nil, err
+		}
+		groupMap[info.Name()] = value
+	}
+
+	return groupMap, nil
+}
+
+func (f *FileBackend) RemoveGroup(group string) error {
+	groupPath, err := f.pathGroup(group)
+	if err != nil {
+		return err
+	}
+
+	lock, err := f.lock(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	return os.RemoveAll(groupPath)
+}
+
+func (f *FileBackend) ListGroups() ([]string, error) {
+	lock, err := f.lock(syscall.LOCK_SH)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Close()
+
+	infos, err := ioutil.ReadDir(f.pathNamespace())
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]string, 0, len(infos))
+	for _, info := range infos {
+		if info.IsDir() && !strings.HasPrefix(info.Name(), ".") {
+			groups = append(groups, info.Name())
+		}
+	}
+
+	sort.Strings(groups)
+	return groups, nil
+}
+
+// syncDir flushes a directory so that a rename within it is durable.
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	if err := dir.Sync(); err != nil {
+		dir.Close()
+		return err
+	}
+
+	return dir.Close()
+}
+
+// WatchGroup polls the group, which works the same way on every platform and
+// filesystem, including network filesystems that don't report changes.
+func (f *FileBackend) WatchGroup(group string, changes chan<- string, started chan<- struct{}, stop <-chan bool) error {
+	if _, err := f.pathGroup(group); err != nil {
+		return err
+	}
+
+	return pollGroup(f, group, WatchPollInterval, changes, started, stop)
+}
+
+type FileAddressError struct {
+	Address string
+}
+
+func (e FileAddressError) Error() string {
+	return fmt.Sprintf("file: address \"%s\" is not a directory path or file:// URI", e.Address)
+}
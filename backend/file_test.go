@@ -0,0 +1,127 @@
+package backend_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/newsdev/context/backend"
+	"github.com/newsdev/context/backend/backendtest"
+)
+
+func tempFileBackend(t *testing.T) (backend.Backend, string) {
+	root, err := ioutil.TempDir("", "context-file-backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := backend.NewBackend("file", "filetest", root)
+	if err != nil {
+		os.RemoveAll(root)
+		t.Fatal(err)
+	}
+
+	return b, root
+}
+
+func TestFileBackend(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) backend.Backend {
+		b, root := tempFileBackend(t)
+		t.Cleanup(func() { os.RemoveAll(root) })
+		return b
+	})
+}
+
+func TestFileBackendAddress(t *testing.T) {
+	for _, address := range []string{"", "file://", "http://127.0.0.1:4001"} {
+		if _, err := backend.NewBackend("file", "filetest", address); err == nil {
+			t.Errorf("expected an error for address %q!", address)
+		} else if _, ok := err.(backend.FileAddressError); !ok {
+			t.Errorf("expected a FileAddressError for address %q but found %v!", address, err)
+		}
+	}
+
+	for _, address := range []string{"/var/lib/context", "file:///var/lib/context", "data"} {
+		if _, err := backend.NewBackend("file", "filetest", address); err != nil {
+			t.Errorf("%s: %s", address, err)
+		}
+	}
+}
+
+func TestFileBackendPermissions(t *testing.T) {
+	b, root := tempFileBackend(t)
+	defer os.RemoveAll(root)
+
+	if err := b.SetVariable("testgroup", "TESTVARIABLE1", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Values are stored with owner-only permissions.
+	info, err := os.Stat(filepath.Join(root, "filetest", "testgroup", "TESTVARIABLE1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("expected file mode 0600 but found %o!", mode)
+	}
+}
+
+func TestFileBackendInvalidNames(t *testing.T) {
+	b, root := tempFileBackend(t)
+	defer os.RemoveAll(root)
+
+	for _, name := range []string{"", ".", "..", ".lock", "a/b", "../escape"} {
+		if err := b.SetVariable("testgroup", name, []byte("value")); err == nil {
+			t.Errorf("expected an error for variable name %q!", name)
+		}
+
+		if err := b.SetVariable(name, "TESTVARIABLE", []byte("value")); err == nil {
+			t.Errorf("expected an error for group name %q!", name)
+		}
+	}
+}
+
+func TestFileBackendConcurrentWrites(t *testing.T) {
+	_, root := tempFileBackend(t)
+	defer os.RemoveAll(root)
+
+	// Use a separate backend for each writer, as separate processes would.
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			b := backend.NewFileBackend("filetest", root)
+			errs <- b.SetVariable("testgroup", fmt.Sprintf("TESTVARIABLE%d", i), []byte(fmt.Sprintf("%d", i)))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	variables, err := backend.NewFileBackend("filetest", root).GetGroup("testgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(variables) != 20 {
+		t.Errorf("expected 20 variables but found %d!", len(variables))
+	}
+
+	// No temporary files should be left behind.
+	infos, err := ioutil.ReadDir(filepath.Join(root, "filetest", "testgroup"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 20 {
+		t.Errorf("expected 20 files but found %d!", len(infos))
+	}
+}
@@ -0,0 +1,194 @@
+package backend
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// memoryStores holds the stores created through NewBackend, keyed by address,
+// so that backends created separately within a process share their data the
+// same way separate clients of a server would.
+var memoryStores = struct {
+	sync.Mutex
+	stores map[string]*memoryStore
+}{stores: make(map[string]*memoryStore)}
+
+type memoryStore struct {
+	sync.RWMutex
+	groups map[string]map[string][]byte
+
+	// watchers maps the channels of running watches to the keys of the
+	// groups they watch.
+	watchers map[chan struct{}]string
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		groups:   make(map[string]map[string][]byte),
+		watchers: make(map[chan struct{}]string),
+	}
+}
+
+// changed wakes the watches of the group with the given key. It must be
+// called with the store locked. Each watch's channel holds at most one
+// pending wake-up, so repeated changes are batched rather than blocking.
+func (s *memoryStore) changed(key string) {
+	for watcher, watched := range s.watchers {
+		if watched == key {
+			select {
+			case watcher <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// A MemoryBackend keeps values in process memory. It is intended for tests
+// and for short-lived processes that have no need for persistence.
+type MemoryBackend struct {
+	namespace string
+	store     *memoryStore
+}
+
+// NewMemoryBackend returns a backend with its own, empty store.
+func NewMemoryBackend(namespace string) *MemoryBackend {
+	return &MemoryBackend{
+		namespace: namespace,
+		store:     newMemoryStore(),
+	}
+}
+
+func newSharedMemoryBackend(namespace, address string) *MemoryBackend {
+	memoryStores.Lock()
+	defer memoryStores.Unlock()
+
+	store, ok := memoryStores.stores[address]
+	if !ok {
+		store = newMemoryStore()
+		memoryStores.stores[address] = store
+	}
+
+	return &MemoryBackend{
+		namespace: namespace,
+		store:     store,
+	}
+}
+
+func (m *MemoryBackend) keyGroup(group string) string {
+	return key(m.namespace, group)
+}
+
+func copyBytes(value []byte) []byte {
+	c := make([]byte, len(value))
+	copy(c, value)
+	return c
+}
+
+func (m *MemoryBackend) Namespace() string {
+	return m.namespace
+}
+
+func (m *MemoryBackend) GetVariable(group, variable string) ([]byte, error) {
+	m.store.RLock()
+	defer m.store.RUnlock()
+
+	value, ok := m.store.groups[m.keyGroup(group)][variable]
+	if !ok {
+		return nil, NoVariableError{group, variable}
+	}
+
+	return copyBytes(value), nil
+}
+
+func (m *MemoryBackend) SetVariable(group, variable string, value []byte) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	key := m.keyGroup(group)
+	if _, ok := m.store.groups[key]; !ok {
+		m.store.groups[key] = make(map[string][]byte)
+	}
+
+	m.store.groups[key][variable] = copyBytes(value)
+	m.store.changed(key)
+	return nil
+}
+
+func (m *MemoryBackend) RemoveVariable(group, variable string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	key := m.keyGroup(group)
+	delete(m.store.groups[key], variable)
+	if len(m.store.groups[key]) == 0 {
+		delete(m.store.groups, key)
+	}
+
+	m.store.changed(key)
+	return nil
+}
+
+func (m *MemoryBackend) GetGroup(group string) (map[string][]byte, error) {
+	m.store.RLock()
+	defer m.store.RUnlock()
+
+	groupMap := make(map[string][]byte)
+	for variable, value := range m.store.groups[m.keyGroup(group)] {
+		groupMap[variable] = copyBytes(value)
+	}
+
+	return groupMap, nil
+}
+
+func (m *MemoryBackend) RemoveGroup(group string) error {
+	m.store.Lock()
+	defer m.store.Unlock()
+
+	key := m.keyGroup(group)
+	delete(m.store.groups, key)
+	m.store.changed(key)
+	return nil
+}
+
+func (m *MemoryBackend) ListGroups() ([]string, error) {
+	m.store.RLock()
+	defer m.store.RUnlock()
+
+	prefix := m.keyGroup("")
+	groups := make([]string, 0)
+	for key := range m.store.groups {
+		if strings.HasPrefix(key, prefix) {
+			groups = append(groups, strings.TrimPrefix(key, prefix))
+		}
+	}
+
+	sort.Strings(groups)
+	return groups, nil
+}
+
+func (m *MemoryBackend) WatchGroup(group string, changes chan<- string, started chan<- struct{}, stop <-chan bool) error {
+	watcher := make(chan struct{}, 1)
+
+	m.store.Lock()
+	m.store.watchers[watcher] = m.keyGroup(group)
+	m.store.Unlock()
+	closeStarted(started)
+
+	defer func() {
+		m.store.Lock()
+		delete(m.store.watchers, watcher)
+		m.store.Unlock()
+	}()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-watcher:
+			if !notify(group, changes, stop) {
+				return nil
+			}
+		}
+	}
+}
@@ -2,8 +2,15 @@ package backend
 
 import (
 	"bytes"
+	"crypto/tls"
 	"errors"
+	"fmt"
 	"log"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/garyburd/redigo/redis"
 )
@@ -11,11 +18,19 @@ import (
 const (
 	MaxIdle int = 2
 	KeySep      = ':'
+
+	RedisDefaultPort = "6379"
 )
 
 type redisBackend struct {
 	namespace, address string
 	pool               *redis.Pool
+
+	// Connections authenticate if a password is set, select the database if
+	// it isn't the default, and use TLS if tlsConfig is set.
+	username, password string
+	database           int
+	tlsConfig          *tls.Config
 }
 
 func NewRedisBackend(namespace, address string) *redisBackend {
@@ -33,8 +48,62 @@ func NewRedisBackend(namespace, address string) *redisBackend {
 	return r
 }
 
+// newRedisBackendFromAddress builds a Redis backend from a host and port,
+// or from a Redis URI.
+func newRedisBackendFromAddress(namespace, address string) (*redisBackend, error) {
+	scheme := uriScheme(address)
+	if scheme == "" {
+		return NewRedisBackend(namespace, address), nil
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, URIError{"redis address could not be parsed"}
+	}
+
+	query := u.Query()
+	if n := query.Get("namespace"); n != "" {
+		namespace = n
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), RedisDefaultPort)
+	}
+
+	r := NewRedisBackend(namespace, host)
+	if u.User != nil {
+		r.username = u.User.Username()
+		r.password, _ = u.User.Password()
+	}
+	if password := query.Get("password"); password != "" {
+		r.password = password
+	}
+
+	// The database may be given as the path or as an option.
+	database := strings.Trim(u.Path, "/")
+	if db := query.Get("db"); db != "" {
+		database = db
+	}
+	if database != "" {
+		if r.database, err = strconv.Atoi(database); err != nil || r.database < 0 {
+			return nil, URIError{fmt.Sprintf("bad redis database \"%s\"", database)}
+		}
+	}
+
+	if scheme == "rediss" {
+		if r.tlsConfig, err = tlsConfig(query); err != nil {
+			return nil, err
+		}
+	} else if err := checkNoTLS(scheme, query); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
 func (r *redisBackend) dial() (redis.Conn, error) {
-	connection, err := redis.Dial("tcp", r.address)
+	connection, err := r.connect()
 	if err != nil {
 		log.Println(err)
 		return nil, err
@@ -42,6 +111,46 @@ func (r *redisBackend) dial() (redis.Conn, error) {
 	return connection, err
 }
 
+// connect opens a connection, then authenticates and selects the database
+// as needed.
+func (r *redisBackend) connect() (redis.Conn, error) {
+	var connection redis.Conn
+	if r.tlsConfig != nil {
+		netConn, err := tls.Dial("tcp", r.address, r.tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		connection = redis.NewConn(netConn, 0, 0)
+	} else {
+		var err error
+		if connection, err = redis.Dial("tcp", r.address); err != nil {
+			return nil, err
+		}
+	}
+
+	// A username needs Redis 6's ACLs, so it is only sent if given.
+	if r.password != "" {
+		args := []interface{}{r.password}
+		if r.username != "" {
+			args = []interface{}{r.username, r.password}
+		}
+
+		if _, err := connection.Do("AUTH", args...); err != nil {
+			connection.Close()
+			return nil, err
+		}
+	}
+
+	if r.database != 0 {
+		if _, err := connection.Do("SELECT", r.database); err != nil {
+			connection.Close()
+			return nil, err
+		}
+	}
+
+	return connection, nil
+}
+
 func (r *redisBackend) Key(group string) []byte {
 	buf := bytes.NewBufferString(r.namespace)
 	buf.WriteRune(KeySep)
@@ -49,6 +158,10 @@ func (r *redisBackend) Key(group string) []byte {
 	return buf.Bytes()
 }
 
+func (r *redisBackend) Namespace() string {
+	return r.namespace
+}
+
 func (r *redisBackend) GetVariable(group, variable string) ([]byte, error) {
 
 	// Get a connection from the pool and defer its closing.
@@ -125,3 +238,76 @@ func (r *redisBackend) RemoveGroup(group string) error {
 	_, err := conn.Do("DEL", r.Key(group))
 	return err
 }
+
+// escapePattern escapes the characters that have special meaning in a Redis
+// glob-style pattern.
+func escapePattern(s string) string {
+	var buf bytes.Buffer
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			buf.WriteRune('\\')
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+func (r *redisBackend) ListGroups() ([]string, error) {
+
+	// Get a connection from the pool and defer its closing.
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	prefix := string(r.Key(""))
+	pattern := escapePattern(prefix) + "*"
+
+	// Iterate with SCAN rather than KEYS so that large databases aren't
+	// blocked while we look.
+	groups := make([]string, 0)
+	cursor := "0"
+	for {
+		values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", pattern))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(values) != 2 {
+			return nil, errors.New("redis: unexpected SCAN reply")
+		}
+
+		cursor, err = redis.String(values[0], nil)
+		if err != nil {
+			return nil, err
+		}
+
+		keys, err := redis.Strings(values[1], nil)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range keys {
+			groups = append(groups, strings.TrimPrefix(key, prefix))
+		}
+
+		if cursor == "0" {
+			break
+		}
+	}
+
+	// SCAN may return a key more than once.
+	sort.Strings(groups)
+	unique := groups[:0]
+	for i, group := range groups {
+		if i == 0 || group != groups[i-1] {
+			unique = append(unique, group)
+		}
+	}
+
+	return unique, nil
+}
+
+// WatchGroup polls the group, since keyspace notifications are disabled by
+// default and can't be enabled without administrative access to the server.
+func (r *redisBackend) WatchGroup(group string, changes chan<- string, started chan<- struct{}, stop <-chan bool) error {
+	return pollGroup(r, group, WatchPollInterval, changes, started, stop)
+}
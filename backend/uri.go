@@ -0,0 +1,88 @@
+package backend
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+)
+
+// uriKinds maps the schemes of backend URIs to the backends they select.
+var uriKinds = map[string]string{
+	"redis":      "redis",
+	"rediss":     "redis",
+	"etcd":       "etcd",
+	"etcd+http":  "etcd",
+	"etcd+https": "etcd",
+}
+
+// uriScheme returns the scheme of address if it is a backend URI.
+func uriScheme(address string) string {
+	i := strings.Index(address, "://")
+	if i < 0 {
+		return ""
+	}
+
+	scheme := strings.ToLower(address[:i])
+	if _, ok := uriKinds[scheme]; !ok {
+		return ""
+	}
+	return scheme
+}
+
+// tlsConfig builds a TLS configuration from the ca, cert and key options of
+// a URI. The server is always verified, against the system's roots unless a
+// CA is given, and a client certificate is only sent if cert and key are.
+func tlsConfig(query url.Values) (*tls.Config, error) {
+	config := &tls.Config{}
+
+	if ca := query.Get("ca"); ca != "" {
+		pem, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, err
+		}
+
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, URIError{fmt.Sprintf("no certificates found in %s", ca)}
+		}
+	}
+
+	cert, key := query.Get("cert"), query.Get("key")
+	if (cert == "") != (key == "") {
+		return nil, URIError{"cert and key must be given together"}
+	}
+
+	if cert != "" {
+		certificate, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config, nil
+}
+
+// checkNoTLS refuses TLS options on a URI whose scheme doesn't use TLS,
+// rather than silently connecting in the clear.
+func checkNoTLS(scheme string, query url.Values) error {
+	for _, option := range []string{"ca", "cert", "key"} {
+		if query.Get(option) != "" {
+			return URIError{fmt.Sprintf("%s needs a TLS scheme, not %s", option, scheme)}
+		}
+	}
+	return nil
+}
+
+// URIError reports a backend URI that can't be used. It never includes the
+// URI itself, which may hold a password.
+type URIError struct {
+	Err string
+}
+
+func (e URIError) Error() string {
+	return fmt.Sprintf("backend: bad URI: %s", e.Err)
+}
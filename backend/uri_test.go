@@ -0,0 +1,230 @@
+package backend_test
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/newsdev/context/backend"
+)
+
+// fakeRedis answers every command on each connection with OK, or with nil
+// for HGET, recording the commands it receives.
+type fakeRedis struct {
+	mu       sync.Mutex
+	commands [][]string
+}
+
+func (f *fakeRedis) serve(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go f.serveConn(conn)
+	}
+}
+
+func (f *fakeRedis) serveConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		command, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		f.mu.Lock()
+		f.commands = append(f.commands, command)
+		f.mu.Unlock()
+
+		reply := "+OK\r\n"
+		if command[0] == "HGET" {
+			reply = "$-1\r\n"
+		}
+		io.WriteString(conn, reply)
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+
+	command := make([]string, n)
+	for i := range command {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		command[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+
+	return command, nil
+}
+
+func (f *fakeRedis) received() [][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.commands
+}
+
+// writeCA writes the certificate of a test TLS server to a file for use as
+// a CA.
+func writeCA(t *testing.T, server *httptest.Server) string {
+	dir, err := ioutil.TempDir("", "context-backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	caPath := filepath.Join(dir, "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caPath, ca, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return caPath
+}
+
+func TestRedisURI(t *testing.T) {
+	for _, tlsScheme := range []bool{false, true} {
+		f := &fakeRedis{}
+		scheme := "redis"
+
+		var l net.Listener
+		var err error
+		var query string
+		if tlsScheme {
+			// Borrow the certificate of a test HTTPS server.
+			server := httptest.NewTLSServer(http.NotFoundHandler())
+			defer server.Close()
+
+			scheme = "rediss"
+			query = "&ca=" + writeCA(t, server)
+			l, err = tls.Listen("tcp", "127.0.0.1:0", server.TLS)
+		} else {
+			l, err = net.Listen("tcp", "127.0.0.1:0")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		go f.serve(l)
+
+		address := fmt.Sprintf("%s://app:p%%40ss@%s/2?namespace=uri%s", scheme, l.Addr(), query)
+		b, err := backend.NewBackend("etcd", "context", address)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if namespace := b.Namespace(); namespace != "uri" {
+			t.Errorf("%s: expected namespace uri but found %s!", scheme, namespace)
+		}
+
+		if _, err := b.GetVariable("group", "A"); !backend.IsNotFound(err) {
+			t.Errorf("%s: expected a missing variable but found %v!", scheme, err)
+		}
+
+		expected := [][]string{
+			{"AUTH", "app", "p@ss"},
+			{"SELECT", "2"},
+			{"HGET", "uri:group", "A"},
+		}
+		if commands := f.received(); !reflect.DeepEqual(commands, expected) {
+			t.Errorf("%s: expected %q but found %q!", scheme, expected, commands)
+		}
+	}
+}
+
+func TestEtcdURI(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Etcd-Index", "1")
+		fmt.Fprintf(w, `{"action":"get","node":{"key":"%s","value":"dmFsdWU=","modifiedIndex":1,"createdIndex":1}}`, strings.TrimPrefix(r.URL.Path, "/v2/keys"))
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "https://")
+	b, err := backend.NewBackend("redis", "context", "etcd+https://"+host+"?namespace=uri&ca="+writeCA(t, server))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if namespace := b.Namespace(); namespace != "uri" {
+		t.Errorf("expected namespace uri but found %s!", namespace)
+	}
+
+	value, err := b.GetVariable("group", "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(value) != "value" {
+		t.Errorf("expected value but found %q!", value)
+	}
+
+	mu.Lock()
+	if expected := "/v2/keys/uri/group/A"; len(paths) != 1 || paths[0] != expected {
+		t.Errorf("expected a request for %s but found %v!", expected, paths)
+	}
+	mu.Unlock()
+
+	// Without the CA, the server can't be verified.
+	b, err = backend.NewBackend("etcd", "context", "etcd+https://"+host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.GetVariable("group", "A"); err == nil {
+		t.Error("expected an unverified server to be refused!")
+	}
+}
+
+func TestBadURIs(t *testing.T) {
+	for _, address := range []string{
+		"redis://127.0.0.1/db",
+		"redis://127.0.0.1/-1",
+		"redis://127.0.0.1?ca=/etc/ssl/ca.pem",
+		"rediss://127.0.0.1?cert=/etc/ssl/cert.pem",
+		"rediss://127.0.0.1?ca=/nonexistent/ca.pem",
+		"etcd://127.0.0.1:4001?cert=/etc/ssl/cert.pem&key=/etc/ssl/key.pem",
+		"etcd+https://127.0.0.1:4001,?ca=/nonexistent/ca.pem",
+		"etcd+https://127.0.0.1:4001?key=/etc/ssl/key.pem",
+	} {
+		if _, err := backend.NewBackend("etcd", "context", address); err == nil {
+			t.Errorf("expected an error for %s!", address)
+		} else if strings.Contains(err.Error(), "127.0.0.1") {
+			t.Errorf("expected the error not to repeat the address but found %v!", err)
+		}
+	}
+}
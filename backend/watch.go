@@ -0,0 +1,76 @@
+package backend
+
+import (
+	"bytes"
+	"time"
+)
+
+// WatchPollInterval is how often backends without a way to be notified of
+// changes check a watched group.
+var WatchPollInterval = 2 * time.Second
+
+// pollGroup watches a group by fetching it every interval and comparing it
+// with the last copy.
+func pollGroup(b Backend, group string, interval time.Duration, changes chan<- string, started chan<- struct{}, stop <-chan bool) error {
+	last, err := b.GetGroup(group)
+	if err != nil {
+		return err
+	}
+	closeStarted(started)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+
+		current, err := b.GetGroup(group)
+		if err != nil {
+			return err
+		}
+
+		if !equalGroups(last, current) {
+			last = current
+			if !notify(group, changes, stop) {
+				return nil
+			}
+		}
+	}
+}
+
+// notify sends group on changes unless stop is closed first, reporting
+// whether it was sent.
+func notify(group string, changes chan<- string, stop <-chan bool) bool {
+	select {
+	case changes <- group:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// closeStarted reports that a watch is in place, if anyone asked.
+func closeStarted(started chan<- struct{}) {
+	if started != nil {
+		close(started)
+	}
+}
+
+func equalGroups(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for variable, value := range a {
+		other, ok := b[variable]
+		if !ok || !bytes.Equal(value, other) {
+			return false
+		}
+	}
+
+	return true
+}
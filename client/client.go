@@ -0,0 +1,222 @@
+// Package client loads groups into a Go program, so that it can read its
+// secrets without running under the exec command.
+//
+//	c, err := client.Open(client.Config{Address: "http://127.0.0.1:4001"})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//
+//	values, err := c.Load("shared", "app")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//
+//	password := values.Getenv("DB_PASSWORD")
+//
+// Groups are merged in order, so that values in later groups override those
+// in earlier ones, as they do with exec. Watch keeps the values up to date
+// in the background.
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/newsdev/context/backend"
+	"github.com/newsdev/context/crypter"
+	"github.com/newsdev/context/options"
+)
+
+const (
+	DefaultBackend   = options.DefaultBackend
+	DefaultAddress   = options.DefaultAddress
+	DefaultNamespace = options.DefaultNamespace
+	DefaultCrypter   = options.DefaultCrypter
+	DefaultKeyPath   = options.DefaultKeyPath
+)
+
+// WatchRetryDelay is how long to wait before watching a group again after
+// its watch failed.
+var WatchRetryDelay = 5 * time.Second
+
+// Config says where to find groups and how to decrypt them. Empty fields
+// are resolved as the commands resolve their flags, from CONTEXT_*
+// environment variables, the profile, the configuration files and then the
+// built-in defaults.
+type Config struct {
+	Backend, Address, Namespace string
+
+	// Profile selects a profile from the configuration files, or
+	// $CONTEXT_PROFILE is used if it is empty.
+	Profile string
+
+	// Crypter is the kind of crypter used for values stored without an
+	// envelope.
+	Crypter string
+
+	// Key is used if it is set, and otherwise the key is read from KeyPath,
+	// which must only be readable by its owner.
+	Key     []byte
+	KeyPath string
+}
+
+// A Client reads and decrypts groups from a backend.
+type Client struct {
+	backend backend.Backend
+	crypter crypter.Crypter
+}
+
+// Open returns a client for the backend and key given by config.
+func Open(config Config) (*Client, error) {
+	settings, err := options.Resolve(config.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	for field, setting := range map[*string]string{
+		&config.Backend:   options.Backend,
+		&config.Address:   options.Address,
+		&config.Namespace: options.Namespace,
+		&config.Crypter:   options.Crypter,
+		&config.KeyPath:   options.KeyPath,
+	} {
+		if *field == "" {
+			*field = settings[setting]
+		}
+	}
+
+	key := config.Key
+	if key == nil {
+		var err error
+		if key, err = crypter.ReadKey(config.KeyPath); err != nil {
+			return nil, err
+		}
+	}
+
+	c, err := crypter.NewEnvelopeReader(config.Crypter, key)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := backend.NewBackend(config.Backend, config.Namespace, config.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(b, c), nil
+}
+
+// New returns a client for a backend and crypter that are already open.
+func New(b backend.Backend, c crypter.Crypter) *Client {
+	return &Client{
+		backend: b,
+		crypter: c,
+	}
+}
+
+// GetGroup returns the decrypted values of a single group.
+func (c *Client) GetGroup(group string) (map[string]string, error) {
+	encryptedEnv, err := c.backend.GetGroup(group)
+	if err != nil {
+		return nil, err
+	}
+
+	env := make(map[string]string, len(encryptedEnv))
+	for variable, encryptedValue := range encryptedEnv {
+		value, err := crypter.ValidateAndDecryptWithData(c.crypter, encryptedValue, crypter.AssociatedData(c.backend.Namespace(), group, variable))
+		if err != nil {
+			return nil, ClientError{fmt.Sprintf("%s: %s: %s", group, variable, err)}
+		}
+		env[variable] = string(value)
+	}
+
+	return env, nil
+}
+
+// merge reads the groups in order, so that later groups override earlier
+// ones.
+func (c *Client) merge(groups []string) (map[string]string, error) {
+	env := make(map[string]string)
+	for _, group := range groups {
+		groupEnv, err := c.GetGroup(group)
+		if err != nil {
+			return nil, err
+		}
+
+		for variable, value := range groupEnv {
+			env[variable] = value
+		}
+	}
+
+	return env, nil
+}
+
+// Load reads and merges the groups once.
+func (c *Client) Load(groups ...string) (*Values, error) {
+	if len(groups) == 0 {
+		return nil, ClientError{"at least one group must be given"}
+	}
+
+	env, err := c.merge(groups)
+	if err != nil {
+		return nil, err
+	}
+
+	return newValues(env), nil
+}
+
+// Watch reads and merges the groups, then keeps the values up to date until
+// Close is called on them. If the groups can't be read again after a change,
+// the previous values are kept and the error is available from Err.
+func (c *Client) Watch(groups ...string) (*Values, error) {
+	values, err := c.Load(groups...)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(chan string)
+	for _, group := range groups {
+		go c.watchGroup(values, group, changes)
+	}
+
+	go func() {
+		for {
+			select {
+			case <-values.stop:
+				return
+			case <-changes:
+			}
+
+			env, err := c.merge(groups)
+			values.update(env, err)
+		}
+	}()
+
+	return values, nil
+}
+
+// watchGroup watches a group until the values are closed, retrying if the
+// watch fails.
+func (c *Client) watchGroup(values *Values, group string, changes chan<- string) {
+	for {
+		err := c.backend.WatchGroup(group, changes, nil, values.stop)
+		if err == nil {
+			return
+		}
+
+		values.update(nil, ClientError{fmt.Sprintf("%s: %s", group, err)})
+		select {
+		case <-values.stop:
+			return
+		case <-time.After(WatchRetryDelay):
+		}
+	}
+}
+
+type ClientError struct {
+	Err string
+}
+
+func (e ClientError) Error() string {
+	return fmt.Sprintf("client: %s", e.Err)
+}
@@ -0,0 +1,261 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/newsdev/context/crypter"
+	"github.com/newsdev/context/options"
+)
+
+func TestMain(m *testing.M) {
+
+	// Keep the host's configuration files and CONTEXT_* variables from
+	// changing the settings the tests open clients with.
+	config, err := ioutil.TempFile("", "context-config")
+	if err != nil {
+		panic(err)
+	}
+	config.Close()
+
+	options.SystemConfigPath = ""
+	for _, variable := range os.Environ() {
+		if strings.HasPrefix(variable, options.EnvPrefix) {
+			os.Unsetenv(strings.SplitN(variable, "=", 2)[0])
+		}
+	}
+	os.Setenv(options.ConfigEnv, config.Name())
+
+	status := m.Run()
+	os.Remove(config.Name())
+	os.Exit(status)
+}
+
+func newTestClient(t *testing.T, address string, groups map[string]map[string]string) *Client {
+	dir, err := ioutil.TempDir("", "context-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	key, err := crypter.NewKey("gcm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyPath := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(keyPath, key, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Open(Config{Backend: "memory", Address: address, Crypter: "gcm", KeyPath: keyPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for group, env := range groups {
+		for variable, value := range env {
+			set(t, c, group, variable, value)
+		}
+	}
+
+	return c
+}
+
+func set(t *testing.T, c *Client, group, variable, value string) {
+	encryptedValue, err := crypter.EncryptAndSignWithData(c.crypter, []byte(value), crypter.AssociatedData(c.backend.Namespace(), group, variable))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.backend.SetVariable(group, variable, encryptedValue); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	c := newTestClient(t, "TestLoad", map[string]map[string]string{
+		"shared": {"A": "shared", "B": "shared"},
+		"app":    {"B": "app"},
+	})
+
+	values, err := c.Load("shared", "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := map[string]string{"A": "shared", "B": "app"}; !reflect.DeepEqual(values.Map(), expected) {
+		t.Errorf("expected %v but found %v!", expected, values.Map())
+	}
+
+	if value := values.Getenv("B"); value != "app" {
+		t.Errorf("expected app but found %q!", value)
+	}
+
+	if _, ok := values.LookupEnv("C"); ok {
+		t.Error("expected C not to be set!")
+	}
+
+	if _, err := c.Load(); err == nil {
+		t.Error("expected an error without groups!")
+	}
+}
+
+func TestOpenKeyMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "context-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyPath := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(keyPath, make([]byte, 32), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(Config{Backend: "memory", Crypter: "gcm", KeyPath: keyPath}); err == nil {
+		t.Error("expected a key readable by others to be refused!")
+	}
+}
+
+func TestOpenSettings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "context-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := crypter.NewKey("gcm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyPath := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(keyPath, key, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Empty fields are filled in from the configuration files and the
+	// profile, as the commands' flags are.
+	configPath := filepath.Join(dir, "config")
+	config := "backend = memory\ncrypter = gcm\n\n[staging]\nnamespace = staging\nkey_path = " + keyPath + "\n"
+	if err := ioutil.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Setenv(options.ConfigEnv, os.Getenv(options.ConfigEnv))
+	os.Setenv(options.ConfigEnv, configPath)
+
+	c, err := Open(Config{Address: "TestOpenSettings", Profile: "staging"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if namespace := c.backend.Namespace(); namespace != "staging" {
+		t.Errorf("expected namespace staging but found %s!", namespace)
+	}
+
+	if _, err := Open(Config{Address: "TestOpenSettings", Profile: "production"}); err == nil {
+		t.Error("expected an error for an unknown profile!")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	c := newTestClient(t, "TestDecode", map[string]map[string]string{
+		"default": {
+			"HOST":    "localhost",
+			"PORT":    "5432",
+			"DEBUG":   "true",
+			"RATIO":   "0.5",
+			"TIMEOUT": "1m30s",
+			"CERT":    "pem",
+		},
+	})
+
+	values, err := c.Load("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var config struct {
+		Host    string        `context:"HOST,required"`
+		Port    uint16        `context:"PORT"`
+		Debug   bool          `context:"DEBUG"`
+		Ratio   float64       `context:"RATIO"`
+		Timeout time.Duration `context:"TIMEOUT"`
+		Cert    []byte        `context:"CERT"`
+		Missing string        `context:"MISSING"`
+		Ignored string
+	}
+	config.Missing = "unchanged"
+
+	if err := values.Decode(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Host != "localhost" || config.Port != 5432 || !config.Debug || config.Ratio != 0.5 || config.Timeout != 90*time.Second || string(config.Cert) != "pem" || config.Missing != "unchanged" {
+		t.Errorf("unexpected config %+v!", config)
+	}
+
+	var required struct {
+		Missing string `context:"MISSING,required"`
+	}
+	if err := values.Decode(&required); err == nil {
+		t.Error("expected an error for a required variable that isn't set!")
+	} else if _, ok := err.(DecodeError); !ok {
+		t.Errorf("expected a DecodeError but found %v!", err)
+	}
+
+	var invalid struct {
+		Host int `context:"HOST"`
+	}
+	if err := values.Decode(&invalid); err == nil {
+		t.Error("expected an error for a value that isn't a number!")
+	}
+
+	if err := values.Decode(config); err == nil {
+		t.Error("expected an error for a struct that isn't a pointer!")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	c := newTestClient(t, "TestWatch", map[string]map[string]string{
+		"default": {"A": "1"},
+	})
+
+	values, err := c.Watch("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer values.Close()
+
+	changed := make(chan struct{}, 1)
+	values.OnChange(func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+
+	// The watch may not have started yet, so keep setting the value until it
+	// is seen.
+	deadline := time.After(5 * time.Second)
+	for values.Getenv("A") != "2" {
+		set(t, c, "default", "A", "2")
+		select {
+		case <-changed:
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			t.Fatalf("expected the change to be loaded but found %q!", values.Getenv("A"))
+		}
+	}
+
+	if err := values.Err(); err != nil {
+		t.Error(err)
+	}
+}
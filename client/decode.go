@@ -0,0 +1,125 @@
+package client
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Decode sets the fields of the struct that dst points to from the values,
+// using the variable named by each field's context tag. Fields without a tag
+// are left alone, as are fields whose variable isn't set, unless the tag has
+// the required option.
+//
+//	type Config struct {
+//		Host     string        `context:"DB_HOST"`
+//		Password string        `context:"DB_PASSWORD,required"`
+//		Timeout  time.Duration `context:"DB_TIMEOUT"`
+//	}
+//
+// Fields may be strings, byte slices, booleans, integers, floats or
+// durations, which are parsed as strconv and time.ParseDuration would.
+func (v *Values) Decode(dst interface{}) error {
+	ptr := reflect.ValueOf(dst)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() || ptr.Elem().Kind() != reflect.Struct {
+		return ClientError{"Decode needs a pointer to a struct"}
+	}
+
+	s := ptr.Elem()
+	for i := 0; i < s.NumField(); i++ {
+		field := s.Type().Field(i)
+		tag := field.Tag.Get("context")
+		if tag == "" || tag == "-" {
+			continue
+		}
+
+		name, options := splitTag(tag)
+		value, ok := v.LookupEnv(name)
+		if !ok {
+			for _, option := range options {
+				if option == "required" {
+					return DecodeError{field.Name, name, "is not set"}
+				}
+			}
+			continue
+		}
+
+		if !s.Field(i).CanSet() {
+			return DecodeError{field.Name, name, "field is not exported"}
+		}
+
+		if err := setField(s.Field(i), value); err != nil {
+			return DecodeError{field.Name, name, err.Error()}
+		}
+	}
+
+	return nil
+}
+
+// splitTag returns the variable named in a struct tag and its options.
+func splitTag(tag string) (string, []string) {
+	parts := strings.Split(tag, ",")
+	return parts[0], parts[1:]
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setField(field reflect.Value, value string) error {
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("unsupported type %s", field.Type())
+		}
+		field.SetBytes([]byte(value))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 0, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 0, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+
+	return nil
+}
+
+// DecodeError reports a variable that couldn't be decoded into a field.
+type DecodeError struct {
+	Field, Variable, Err string
+}
+
+func (e DecodeError) Error() string {
+	return fmt.Sprintf("client: %s (%s): %s", e.Variable, e.Field, e.Err)
+}
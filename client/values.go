@@ -0,0 +1,91 @@
+package client
+
+import (
+	"sync"
+)
+
+// Values holds the merged values of some groups. It is safe to use from
+// several goroutines, including while it is being updated by a watch.
+type Values struct {
+	mu       sync.RWMutex
+	env      map[string]string
+	err      error
+	onChange []func()
+
+	stop      chan bool
+	closeOnce sync.Once
+}
+
+func newValues(env map[string]string) *Values {
+	return &Values{
+		env:  env,
+		stop: make(chan bool),
+	}
+}
+
+// update replaces the values, or records the error that prevented it.
+func (v *Values) update(env map[string]string, err error) {
+	v.mu.Lock()
+	v.err = err
+	if err == nil {
+		v.env = env
+	}
+	onChange := v.onChange
+	v.mu.Unlock()
+
+	if err == nil {
+		for _, f := range onChange {
+			f()
+		}
+	}
+}
+
+// Getenv returns the value of a variable, or an empty string if it isn't
+// set, like os.Getenv.
+func (v *Values) Getenv(name string) string {
+	value, _ := v.LookupEnv(name)
+	return value
+}
+
+// LookupEnv returns the value of a variable and whether it is set, like
+// os.LookupEnv.
+func (v *Values) LookupEnv(name string) (string, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	value, ok := v.env[name]
+	return value, ok
+}
+
+// Map returns a copy of every value.
+func (v *Values) Map() map[string]string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	env := make(map[string]string, len(v.env))
+	for name, value := range v.env {
+		env[name] = value
+	}
+	return env
+}
+
+// Err returns the error from the last attempt to watch or read the groups
+// again, or nil if the values were last updated successfully.
+func (v *Values) Err() error {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.err
+}
+
+// OnChange adds a function to call each time watched values are updated.
+// Functions are called from the watch's goroutine, so they should not block.
+func (v *Values) OnChange(f func()) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.onChange = append(v.onChange, f)
+}
+
+// Close stops watching for changes. The values can still be read.
+func (v *Values) Close() {
+	v.closeOnce.Do(func() { close(v.stop) })
+}
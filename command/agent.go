@@ -0,0 +1,139 @@
+package command
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/newsdev/context/agent"
+	"github.com/newsdev/context/backend"
+	"github.com/newsdev/context/crypter"
+	"github.com/newsdev/context/options"
+)
+
+const (
+	DefaultAgentSocket = "/run/context/agent.sock"
+)
+
+type AgentCommand struct{}
+
+func (s *AgentCommand) Run(args []string) int {
+	var keyPath, socketPath, allowUids, allowGids, crypterType, backendType, backendAddress, backendNamespace string
+	var groups groupList
+	flagArgs := newOptionFlags("agent")
+	flagArgs.Option(&backendAddress, "a", options.Address, "backend address")
+	flagArgs.Option(&backendNamespace, "n", options.Namespace, "backend namespace prefix")
+	flagArgs.DeprecatedProtocol()
+	flagArgs.Option(&backendType, "backend", options.Backend, "backend to use")
+	flagArgs.Option(&crypterType, "crypter", options.Crypter, "crypter to use for values without an envelope")
+	flagArgs.Var(&groups, "g", "group to serve, repeated or comma-separated (default every group)")
+	flagArgs.Option(&keyPath, "k", options.KeyPath, "path to a key file")
+	flagArgs.StringVar(&socketPath, "s", DefaultAgentSocket, "path of the socket to listen on")
+	flagArgs.StringVar(&allowUids, "allow-uid", fmt.Sprint(os.Getuid()), "comma-separated user ids allowed to connect")
+	flagArgs.StringVar(&allowGids, "allow-gid", "", "comma-separated group ids allowed to connect")
+	if err := flagArgs.Parse(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	policy := &agent.Policy{}
+	var err error
+	if policy.Uids, err = agent.ParseIds(allowUids); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if policy.Gids, err = agent.ParseIds(allowGids); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// Read the key, checking its permissions. It is held in memory from here
+	// on, so the file itself need only be readable when the agent starts.
+	key, err := crypter.ReadKey(keyPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	c, err := crypter.NewEnvelopeReader(crypterType, key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	b, err := backend.NewBackend(backendType, backendNamespace, backendAddress)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	l, err := listenAgent(socketPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// Closing the listener removes the socket and stops the server.
+	stopped := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		close(stopped)
+		l.Close()
+	}()
+
+	server := agent.NewServer(&backendSource{b, c}, policy)
+	server.Groups = groups
+	if err := server.Serve(l); err != nil {
+		select {
+		case <-stopped:
+		default:
+			l.Close()
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// listenAgent listens on a Unix socket at path, replacing a socket left
+// behind by an agent that is no longer running. Anyone may connect to the
+// socket, as each peer is checked against the policy once connected.
+func listenAgent(path string) (*net.UnixListener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("an agent is already listening on %s", path)
+		}
+
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, 0666); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (s *AgentCommand) Help() string { return "" }
+
+func (s *AgentCommand) Synopsis() string { return "" }
@@ -0,0 +1,71 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/newsdev/context/agent"
+	"github.com/newsdev/context/backend"
+	"github.com/newsdev/context/crypter"
+)
+
+func TestExecCommandAgent(t *testing.T) {
+	keyPath, c := writeTestKey(t, "gcm")
+
+	b, err := backend.NewBackend("memory", "context", "TestExecCommandAgent")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encryptedValue, err := crypter.EncryptAndSignWithData(c, []byte("secret"), crypter.AssociatedData("context", "testgroup", "A"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.SetVariable("testgroup", "A", encryptedValue); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Dir(keyPath)
+	socketPath := filepath.Join(dir, "run", "agent.sock")
+	l, err := listenAgent(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	server := agent.NewServer(&backendSource{b, c}, &agent.Policy{Uids: []int{os.Getuid()}})
+	go server.Serve(l)
+
+	// A second agent can't take over the socket while the first is running.
+	if _, err := listenAgent(socketPath); err == nil {
+		t.Error("expected a second agent to be refused!")
+	}
+
+	// The key file isn't needed when the agent is used.
+	if err := os.Remove(keyPath); err != nil {
+		t.Fatal(err)
+	}
+
+	outputPath := filepath.Join(dir, "output")
+	e := &ExecCommand{}
+	status := e.Run([]string{
+		"-agent", socketPath, "-k", keyPath, "-g", "testgroup", "-supervise",
+		"sh", "-c", `echo "$A" > "$1"`, "sh", outputPath,
+	})
+
+	if status != 0 {
+		t.Fatalf("expected exit status 0 but found %d!", status)
+	}
+
+	output, err := ioutil.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "secret\n"; string(output) != expected {
+		t.Errorf("expected %q but found %q!", expected, output)
+	}
+}
@@ -0,0 +1,65 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/newsdev/context/environment"
+	"github.com/newsdev/context/template"
+)
+
+// minimalEnvironment is the set of variables inherited with -inherit minimal:
+// enough for most programs to find their tools, locale and home directory.
+var minimalEnvironment = &template.Filter{
+	Include: []string{"PATH", "HOME", "USER", "LOGNAME", "SHELL", "LANG", "LC_*", "TERM", "TZ", "TMPDIR"},
+}
+
+// inheritedEnv returns the parts of the current environment that the child
+// should start from. The mode is one of all, minimal or none, and the filter
+// narrows it further.
+func inheritedEnv(mode string, filter *template.Filter) (environment.Environment, error) {
+	var modeFilter *template.Filter
+	switch mode {
+	case "all":
+	case "minimal":
+		modeFilter = minimalEnvironment
+	case "none":
+		return make(environment.Environment), nil
+	default:
+		return nil, fmt.Errorf("unknown value \"%s\" for -inherit", mode)
+	}
+
+	return environment.Parse(os.Environ()).Filter(func(name string) bool {
+		return modeFilter.Match(name) && filter.Match(name)
+	}), nil
+}
+
+// selectGroupEnv returns the group variables that the filter accepts, which
+// is applied to their stored names, renamed by removing stripPrefix where
+// present and then adding addPrefix.
+func selectGroupEnv(groupEnv map[string]string, filter *template.Filter, stripPrefix, addPrefix string) (map[string]string, error) {
+	env := make(map[string]string, len(groupEnv))
+	renamed := make(map[string]string, len(groupEnv))
+	for variable, value := range groupEnv {
+		if !filter.Match(variable) {
+			continue
+		}
+
+		name := addPrefix + strings.TrimPrefix(variable, stripPrefix)
+
+		// Renaming could map two variables onto one name. Rather than pick one
+		// silently, refuse to run.
+		if other, ok := renamed[name]; ok {
+			if other > variable {
+				other, variable = variable, other
+			}
+			return nil, fmt.Errorf("%s and %s would both be named %s", other, variable, name)
+		}
+
+		renamed[name] = variable
+		env[name] = value
+	}
+
+	return env, nil
+}
@@ -0,0 +1,83 @@
+package command
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/newsdev/context/template"
+)
+
+func TestInheritedEnv(t *testing.T) {
+	os.Setenv("CONTEXT_TEST_INHERIT", "yes")
+	defer os.Unsetenv("CONTEXT_TEST_INHERIT")
+
+	os.Setenv("CONTEXT_TEST_EQUALS", "a=b==")
+	defer os.Unsetenv("CONTEXT_TEST_EQUALS")
+
+	env, err := inheritedEnv("all", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env["CONTEXT_TEST_INHERIT"] != "yes" {
+		t.Error("expected all variables to be inherited!")
+	}
+	if value := env["CONTEXT_TEST_EQUALS"]; value != "a=b==" {
+		t.Errorf("expected \"a=b==\" but found %q!", value)
+	}
+
+	env, err = inheritedEnv("all", &template.Filter{Exclude: []string{"CONTEXT_TEST_*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := env["CONTEXT_TEST_INHERIT"]; ok {
+		t.Error("expected an excluded variable not to be inherited!")
+	}
+
+	env, err = inheritedEnv("minimal", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := env["CONTEXT_TEST_INHERIT"]; ok {
+		t.Error("expected only the minimal environment to be inherited!")
+	}
+	if path, ok := os.LookupEnv("PATH"); ok && env["PATH"] != path {
+		t.Error("expected PATH to be inherited!")
+	}
+
+	env, err = inheritedEnv("none", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(env) != 0 {
+		t.Errorf("expected an empty environment but found %q!", env)
+	}
+
+	if _, err := inheritedEnv("some", nil); err == nil {
+		t.Error("expected an error for an unknown mode!")
+	}
+}
+
+func TestSelectGroupEnv(t *testing.T) {
+	groupEnv := map[string]string{"APP_DB_URL": "a", "APP_SECRET": "b", "OTHER": "c"}
+
+	env, err := selectGroupEnv(groupEnv, &template.Filter{Exclude: []string{"*SECRET"}}, "APP_", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]string{"DB_URL": "a", "OTHER": "c"}; !reflect.DeepEqual(env, expected) {
+		t.Errorf("expected %q but found %q!", expected, env)
+	}
+
+	env, err = selectGroupEnv(groupEnv, &template.Filter{Include: []string{"APP_*"}}, "APP_", "MY_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]string{"MY_DB_URL": "a", "MY_SECRET": "b"}; !reflect.DeepEqual(env, expected) {
+		t.Errorf("expected %q but found %q!", expected, env)
+	}
+
+	if _, err := selectGroupEnv(map[string]string{"APP_A": "1", "A": "2"}, nil, "APP_", ""); err == nil {
+		t.Error("expected an error when two variables are renamed to one name!")
+	}
+}
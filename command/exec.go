@@ -1,16 +1,20 @@
 package command
 
 import (
-	"flag"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"os/exec"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/newsdev/context/agent"
 	"github.com/newsdev/context/backend"
 	"github.com/newsdev/context/crypter"
+	"github.com/newsdev/context/environment"
+	"github.com/newsdev/context/options"
+	"github.com/newsdev/context/supervisor"
+	"github.com/newsdev/context/template"
 )
 
 const (
@@ -23,129 +27,330 @@ type ExecCommand struct {
 }
 
 func (s *ExecCommand) Run(args []string) int {
-	var keyPath, group, template, crypterType, backendType, backendProtocol, backendAddress, backendNamespace string
-	flagArgs := flag.NewFlagSet("exec", flag.ContinueOnError)
-	flagArgs.StringVar(&backendAddress, "a", "http://127.0.0.1:4001", "backend address")
-	flagArgs.StringVar(&backendNamespace, "n", "context", "backend namespace prefix")
-	flagArgs.StringVar(&backendProtocol, "protocol", "tcp", "backend protocol")
-	flagArgs.StringVar(&backendType, "backend", "etcd", "backend to use")
-	flagArgs.StringVar(&crypterType, "crypter", "std", "crypter to use")
-	flagArgs.StringVar(&group, "g", "default", "group")
-	flagArgs.StringVar(&keyPath, "k", "/etc/context/key", "path to a key file")
-	flagArgs.StringVar(&template, "t", "", "cli template")
+	var keyPath, agentPath, runAs, templateText, templateInclude, templateExclude, crypterType, backendType, backendAddress, backendNamespace string
+	var filesPatterns, filesDir string
+	var inherit, inheritInclude, inheritExclude, include, exclude, stripPrefix, addPrefix string
+	var groups groupList
+	var showSources, supervised, watch bool
+	var onChange string
+	var debounce time.Duration
+	flagArgs := newOptionFlags("exec")
+	flagArgs.Option(&backendAddress, "a", options.Address, "backend address")
+	flagArgs.Option(&backendNamespace, "n", options.Namespace, "backend namespace prefix")
+	flagArgs.DeprecatedProtocol()
+	flagArgs.Option(&backendType, "backend", options.Backend, "backend to use")
+	flagArgs.Option(&crypterType, "crypter", options.Crypter, "crypter to use for values without an envelope")
+	flagArgs.OptionVar(&groups, "g", options.Group, "group, repeated or comma-separated to merge several in order (default \"default\")")
+	flagArgs.BoolVar(&showSources, "sources", false, "print the group each variable came from")
+	flagArgs.Option(&keyPath, "k", options.KeyPath, "path to a key file")
+	flagArgs.StringVar(&agentPath, "agent", "", "path to the socket of an agent to get groups from, in place of the key and backend")
+	flagArgs.StringVar(&runAs, "u", "", "user[:group] to run the command as")
+	flagArgs.StringVar(&templateText, "t", "", "cli template")
+	flagArgs.StringVar(&templateInclude, "t-include", "", "comma-separated patterns of variables to expand the template for")
+	flagArgs.StringVar(&templateExclude, "t-exclude", "", "comma-separated patterns of variables not to expand the template for")
+	flagArgs.BoolVar(&supervised, "supervise", false, "run the command as a child, forwarding signals and passing back its exit status")
+	flagArgs.BoolVar(&watch, "watch", false, "watch the groups for changes, implying -supervise")
+	flagArgs.StringVar(&onChange, "on-change", "restart", "what to do when the groups change: restart, or the name of a signal to send, which needs -files")
+	flagArgs.DurationVar(&debounce, "debounce", time.Second, "how long to wait for changes to stop before acting on them")
+	flagArgs.StringVar(&filesPatterns, "files", "", "comma-separated patterns of group variables to pass as files rather than values")
+	flagArgs.StringVar(&filesDir, "files-dir", "", "directory to create the private directory of files in (default /dev/shm where available)")
+	flagArgs.StringVar(&inherit, "inherit", "all", "variables to inherit from the current environment: all, minimal or none")
+	flagArgs.StringVar(&inheritInclude, "inherit-include", "", "comma-separated patterns of variables to inherit")
+	flagArgs.StringVar(&inheritExclude, "inherit-exclude", "", "comma-separated patterns of variables not to inherit")
+	flagArgs.StringVar(&include, "include", "", "comma-separated patterns of group variables to use")
+	flagArgs.StringVar(&exclude, "exclude", "", "comma-separated patterns of group variables not to use")
+	flagArgs.StringVar(&stripPrefix, "strip-prefix", "", "prefix to remove from group variable names")
+	flagArgs.StringVar(&addPrefix, "add-prefix", "", "prefix to add to group variable names")
 	if err := flagArgs.Parse(args); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return 1
 	}
 
-	// Check the status of the secret file.
-	stat, err := os.Stat(keyPath)
+	// Parse the template before doing anything else, so that mistakes in it
+	// are reported without touching the backend.
+	tmpl, err := template.Parse(templateText)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return 1
 	}
 
-	// Only proceed if the running user is the only user that can read the
-	// secret.
-	if mode := stat.Mode(); mode != 0600 && mode != 0400 {
-		fmt.Fprintln(os.Stderr, "incorrect file mode for key")
-		return 1
+	// A signal of 0 means restarting rather than signalling.
+	var changeSignal syscall.Signal
+	if onChange != "restart" {
+		if changeSignal, err = parseSignal(onChange); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
 	}
 
-	// Attempt to read the entire content of the secret file.
-	file, err := os.Open(keyPath)
+	filter, err := template.NewFilter(templateInclude, templateExclude)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return 1
 	}
 
-	// The key should have been saved as a binary, so no extra processing
-	// should be needed.
-	key, err := ioutil.ReadAll(file)
+	groupFilter, err := template.NewFilter(include, exclude)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		if err := file.Close(); err != nil {
+		return 1
+	}
+
+	// Files are only written for variables matching a pattern, so no patterns
+	// means no files.
+	var filesFilter *template.Filter
+	if filesPatterns != "" {
+		if filesFilter, err = template.NewFilter(filesPatterns, ""); err != nil {
 			fmt.Fprintln(os.Stderr, err)
+			return 1
 		}
-		return 1
 	}
 
-	// No need to keep the file open.
-	if err := file.Close(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
+	// A signal can only bring new values to a running command through its
+	// files, since its environment is fixed once it starts.
+	if watch && changeSignal != 0 && filesFilter == nil {
+		fmt.Fprintln(os.Stderr, "-on-change with a signal needs -files, as the environment of a running command can't change")
 		return 1
 	}
 
-	// Use the key to create a new crypter of the given type.
-	c, err := crypter.NewCrypter(crypterType, key)
+	inheritFilter, err := template.NewFilter(inheritInclude, inheritExclude)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return 1
 	}
 
-	// Create a new backend of the given type.
-	b, err := backend.NewBackend(backendType, backendNamespace, backendAddress)
+	// Start from as much of the current environment as was asked for. Values
+	// from the groups are added on top.
+	inherited, err := inheritedEnv(inherit, inheritFilter)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return 1
 	}
 
-	// Get all of the values belonging to this group at once.
-	ecryptedEnv, err := b.GetGroup(group)
+	if len(groups) == 0 {
+		groups = groupList{options.DefaultGroup}
+	}
+
+	// Resolve the user up front as well. The key is still read as the current
+	// user, and privileges are only dropped just before the command is run.
+	var cred *credential
+	if runAs != "" {
+		if cred, err = lookupCredential(runAs); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	// Find the expanded path to the given executable.
+	command, err := exec.LookPath(flagArgs.Arg(0))
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return 1
 	}
 
-	// We want to use the current environment as a starting point and
-	// overwrite values that are also specified in the encrypted environment.
-	env := make(map[string]string)
-	for _, variable := range os.Environ() {
-		components := strings.Split(variable, `=`)
-		env[components[0]] = components[1]
-	}
+	// Get the groups from an agent if one was given, or from the backend
+	// directly using the key.
+	var source agent.Source
+	if agentPath != "" {
+		source = agent.NewClient(agentPath)
+	} else {
 
-	// In order to correctly pass templated arguments, the template must be
-	// split along spaces. This doesn't take into account nested strings or
-	// escape sequences, which could be problematic.
-	//
-	// TODO: Better template parsing method.
-	templateSplit := strings.Split(template, ` `)
-	templateArgs := make([]string, 0)
+		// Read the key, checking its permissions.
+		key, err := crypter.ReadKey(keyPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
 
-	for variable, encryptedValue := range ecryptedEnv {
+		// Use the key to create a new crypter. Values name the crypter that
+		// produced them, so the given type only applies to older values.
+		c, err := crypter.NewEnvelopeReader(crypterType, key)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
 
-		value, err := c.ValidateAndDecrypt(encryptedValue)
+		// Create a new backend of the given type.
+		b, err := backend.NewBackend(backendType, backendNamespace, backendAddress)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			return 1
 		}
 
-		env[variable] = string(value)
+		source = &backendSource{b, c}
+	}
+
+	r := &execRunner{
+		source:         source,
+		groups:         groups,
+		inherited:      inherited,
+		groupFilter:    groupFilter,
+		stripPrefix:    stripPrefix,
+		addPrefix:      addPrefix,
+		filesFilter:    filesFilter,
+		template:       tmpl,
+		templateFilter: filter,
+		cred:           cred,
+		args:           flagArgs.Args(),
+	}
 
-		for _, templateComponent := range templateSplit {
-			templateArgs = append(templateArgs, strings.Replace(templateComponent, ExecTemplateToken, variable, -1))
+	// Files can only be removed once the command exits, so it has to run as
+	// a child of this process.
+	if filesFilter != nil {
+		if filesDir == "" {
+			filesDir = secretFilesBase()
 		}
+
+		if r.dir, err = newSecretFilesDir(filesDir, cred); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		supervised = true
 	}
 
-	// Find the expanded path to the given executable.
-	command, err := exec.LookPath(flagArgs.Arg(0))
+	// From here on the files must be removed before returning.
+	cleanup := func() {
+		if r.dir != "" {
+			if err := os.RemoveAll(r.dir); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+	}
+
+	layered, commandArgs, commandEnv, err := r.prepare()
 	if err != nil {
+		cleanup()
 		fmt.Fprintln(os.Stderr, err)
 		return 1
 	}
 
+	if showSources {
+		layered.writeSources(os.Stderr)
+	}
+
+	if supervised || watch {
+		s := supervisor.New(newCommand(command, commandArgs, commandEnv, cred))
+		s.OnExit(cleanup)
+
+		if watch {
+			stop, stopped := make(chan bool), make(chan bool)
+			go func() {
+				r.watch(s, command, changeSignal, debounce, stop)
+				close(stopped)
+			}()
+
+			// Stop watching, and wait for any update in progress, before
+			// the files are removed. Functions added later run first.
+			s.OnExit(func() {
+				close(stop)
+				<-stopped
+			})
+		}
+
+		status, err := s.Run()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return status
+	}
+
+	// Give up the privileges needed to read the key, so that the command
+	// never has access to it.
+	if cred != nil {
+		if err := cred.drop(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	if err := syscall.Exec(command, commandArgs, commandEnv); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
+
+// An execRunner builds the command's arguments and environment from the
+// groups, which it may do again whenever they change.
+type execRunner struct {
+	source    agent.Source
+	groups    []string
+	inherited environment.Environment
+
+	groupFilter            *template.Filter
+	stripPrefix, addPrefix string
+
+	// Variables matching filesFilter are written to files in dir rather than
+	// passed in the environment.
+	filesFilter *template.Filter
+	dir         string
+
+	template       *template.Template
+	templateFilter *template.Filter
+	cred           *credential
+	args           []string
+}
+
+// prepare decrypts the groups and returns the command's arguments and
+// environment, updating any files along the way.
+func (r *execRunner) prepare() (*layeredEnv, []string, []string, error) {
+
+	// Merge the groups in order, so that later groups override earlier ones.
+	layered, err := mergeGroups(r.source, r.groups)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	groupEnv, err := selectGroupEnv(layered.Env, r.groupFilter, r.stripPrefix, r.addPrefix)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	env := make(environment.Environment, len(r.inherited)+len(groupEnv))
+	env.Merge(r.inherited)
+
+	// Variables passed as files are kept out of the environment entirely,
+	// including any inherited value of the same name.
+	fileEnv := make(map[string]string)
+	for variable, value := range groupEnv {
+		if r.filesFilter != nil && r.filesFilter.Match(variable) {
+			fileEnv[variable] = value
+			delete(env, variable)
+		} else {
+			env[variable] = value
+		}
+	}
+
+	var files map[string]string
+	if r.dir != "" {
+		if files, err = updateSecretFiles(r.dir, fileEnv, r.cred); err != nil {
+			return nil, nil, nil, err
+		}
+
+		for variable, path := range files {
+			env[variable+FileSuffix] = path
+		}
+	}
+
+	if r.cred != nil {
+		r.cred.setEnvironment(env)
+	}
+
 	// Exec expects the environment to be specified as a slice rather than a
-	// map. Flatten it by joining keys and values with `=`.
-	commandEnv := make([]string, 0, len(env))
-	for key, value := range env {
-		commandEnv = append(commandEnv, fmt.Sprintf(`%s=%s`, key, value))
+	// map, which is built in order of name.
+	commandEnv, err := env.Environ()
+	if err != nil {
+		return nil, nil, nil, err
 	}
 
+	// Expand the template once for each variable used from the groups, in
+	// order of name so that the resulting command is reproducible.
+	templateArgs := r.template.ExpandAll(groupEnv, files, r.templateFilter)
+
 	// Replace the template token in the given command argument slice with the
 	// template arguments slice.
 	commandArgs := make([]string, 0)
-	for _, arg := range flagArgs.Args() {
+	for _, arg := range r.args {
 		if arg == ExecTemplateToken {
 			commandArgs = append(commandArgs, templateArgs...)
 		} else {
@@ -153,12 +358,37 @@ func (s *ExecCommand) Run(args []string) int {
 		}
 	}
 
-	if err := syscall.Exec(command, commandArgs, commandEnv); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
-	}
+	return layered, commandArgs, commandEnv, nil
+}
 
-	return 0
+// watch acts on changes to the groups until stop is closed, either by
+// restarting the command with the new values or, if sig is not 0, by
+// updating any files and sending sig. If the new values can't be used, the
+// command is left running as it is.
+func (r *execRunner) watch(s *supervisor.Supervisor, command string, sig syscall.Signal, debounce time.Duration, stop <-chan bool) {
+	batches := watchGroups(r.source, r.groups, debounce, stop)
+	for {
+		var batch []string
+		select {
+		case <-stop:
+			return
+		case batch = <-batches:
+		}
+
+		_, commandArgs, commandEnv, err := r.prepare()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+
+		if sig == 0 {
+			fmt.Fprintf(os.Stderr, "%s changed, restarting\n", strings.Join(batch, ", "))
+			s.Restart(newCommand(command, commandArgs, commandEnv, r.cred))
+		} else {
+			fmt.Fprintf(os.Stderr, "%s changed, sending %s\n", strings.Join(batch, ", "), sig)
+			s.Signal(sig)
+		}
+	}
 }
 
 func (s *ExecCommand) Help() string { return "" }
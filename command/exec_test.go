@@ -0,0 +1,145 @@
+package command
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/newsdev/context/backend"
+	"github.com/newsdev/context/crypter"
+)
+
+func TestExecCommandFiles(t *testing.T) {
+	keyPath, c := writeTestKey(t, "gcm")
+
+	b, err := backend.NewBackend("memory", "context", "TestExecCommandFiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for variable, value := range map[string]string{"DB_PASSWORD": "secret", "DB_HOST": "localhost"} {
+		encryptedValue, err := crypter.EncryptAndSignWithData(c, []byte(value), crypter.AssociatedData("context", "testgroup", variable))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := b.SetVariable("testgroup", variable, encryptedValue); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filesDir := filepath.Dir(keyPath)
+	outputPath := filepath.Join(filesDir, "output")
+
+	// The command records what it saw, then exits with a status that must be
+	// passed on.
+	script := `test -z "$DB_PASSWORD" && test "$DB_HOST" = localhost && cat "$DB_PASSWORD_FILE" > "$1" && echo "$2" >> "$1"; exit 3`
+
+	e := &ExecCommand{}
+	status := e.Run([]string{
+		"-backend", "memory", "-a", "TestExecCommandFiles", "-crypter", "gcm", "-k", keyPath, "-g", "testgroup",
+		"-files", "*PASSWORD", "-files-dir", filesDir, "-t", "{file}", "-t-include", "DB_PASSWORD",
+		"sh", "-c", script, "sh", outputPath, "{}",
+	})
+
+	if status != 3 {
+		t.Errorf("expected exit status 3 but found %d!", status)
+	}
+
+	output, err := ioutil.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The files are removed once the command exits.
+	matches, err := filepath.Glob(filepath.Join(filesDir, "context-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("expected the files to be removed but found %v!", matches)
+	}
+
+	// The template was expanded with the path of the file, which no longer
+	// exists.
+	if expected := "secret"; !strings.HasPrefix(string(output), expected) {
+		t.Errorf("expected the file to hold %q but found %q!", expected, output)
+	} else if path := strings.TrimSpace(strings.TrimPrefix(string(output), expected)); filepath.Base(path) != "DB_PASSWORD" {
+		t.Errorf("expected the path of the DB_PASSWORD file but found %q!", path)
+	}
+}
+
+func TestExecCommandWatch(t *testing.T) {
+	keyPath, c := writeTestKey(t, "gcm")
+
+	b, err := backend.NewBackend("memory", "context", "TestExecCommandWatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setValue := func(value string) {
+		encryptedValue, err := crypter.EncryptAndSignWithData(c, []byte(value), crypter.AssociatedData("context", "testgroup", "A"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := b.SetVariable("testgroup", "A", encryptedValue); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setValue("1")
+
+	// The command records each value it starts with, running until it sees
+	// the second.
+	outputPath := filepath.Join(filepath.Dir(keyPath), "output")
+	script := `echo "$A" >> "$1"; test "$A" = 2 && exit 9; trap 'exit 0' TERM; while :; do sleep 0.01; done`
+
+	// The watch may not have started by the time the command has, so keep
+	// changing the value until the command sees it.
+	go func() {
+		for i := 0; i < 500; i++ {
+			if output, err := ioutil.ReadFile(outputPath); err == nil {
+				if string(output) != "1\n" {
+					return
+				}
+				setValue("2")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	e := &ExecCommand{}
+	status := e.Run([]string{
+		"-backend", "memory", "-a", "TestExecCommandWatch", "-crypter", "gcm", "-k", keyPath, "-g", "testgroup",
+		"-watch", "-debounce", "10ms",
+		"sh", "-c", script, "sh", outputPath,
+	})
+
+	if status != 9 {
+		t.Errorf("expected exit status 9 but found %d!", status)
+	}
+
+	output, err := ioutil.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "1\n2\n"; string(output) != expected {
+		t.Errorf("expected %q but found %q!", expected, output)
+	}
+}
+
+func TestExecCommandWatchSignalNeedsFiles(t *testing.T) {
+	e := &ExecCommand{}
+	status := e.Run([]string{
+		"-backend", "memory", "-a", "TestExecCommandWatchSignalNeedsFiles", "-g", "testgroup",
+		"-watch", "-on-change", "HUP",
+		"true",
+	})
+
+	if status != 1 {
+		t.Errorf("expected exit status 1 but found %d!", status)
+	}
+}
@@ -0,0 +1,106 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/newsdev/context/backend"
+	"github.com/newsdev/context/crypter"
+	"github.com/newsdev/context/envfile"
+	"github.com/newsdev/context/options"
+)
+
+type ExportCommand struct{}
+
+func (s *ExportCommand) Run(args []string) int {
+	var keyPath, group, format, outputPath, crypterType, backendType, backendAddress, backendNamespace string
+	flagArgs := newOptionFlags("export")
+	flagArgs.Option(&backendAddress, "a", options.Address, "backend address")
+	flagArgs.Option(&backendNamespace, "n", options.Namespace, "backend namespace prefix")
+	flagArgs.DeprecatedProtocol()
+	flagArgs.Option(&backendType, "backend", options.Backend, "backend to use")
+	flagArgs.Option(&crypterType, "crypter", options.Crypter, "crypter to use for values without an envelope")
+	flagArgs.Option(&group, "g", options.Group, "group")
+	flagArgs.Option(&keyPath, "k", options.KeyPath, "path to a key file")
+	flagArgs.StringVar(&format, "format", "dotenv", "output format: dotenv, docker, json, yaml, shell or systemd")
+	flagArgs.StringVar(&outputPath, "o", "", "write to a file with mode 0600 instead")
+	if err := flagArgs.Parse(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// Read the key, checking its permissions.
+	key, err := crypter.ReadKey(keyPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	c, err := crypter.NewEnvelopeReader(crypterType, key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	b, err := backend.NewBackend(backendType, backendNamespace, backendAddress)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	encryptedEnv, err := b.GetGroup(group)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	env, err := decryptGroup(c, b.Namespace(), group, encryptedEnv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// Format everything before writing anything, so that an error doesn't
+	// leave a partial file behind.
+	var buf bytes.Buffer
+	if err := envfile.Write(&buf, format, env); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if outputPath != "" {
+		if err := writePrivateFile(outputPath, buf.Bytes()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	if _, err := buf.WriteTo(os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
+
+// decryptGroup decrypts every value in encryptedEnv, which was read from
+// group.
+func decryptGroup(c crypter.Crypter, namespace, group string, encryptedEnv map[string][]byte) (map[string]string, error) {
+	env := make(map[string]string, len(encryptedEnv))
+	for variable, encryptedValue := range encryptedEnv {
+		value, err := crypter.ValidateAndDecryptWithData(c, encryptedValue, crypter.AssociatedData(namespace, group, variable))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", variable, err)
+		}
+
+		env[variable] = string(value)
+	}
+
+	return env, nil
+}
+
+func (s *ExportCommand) Help() string { return "" }
+
+func (s *ExportCommand) Synopsis() string { return "" }
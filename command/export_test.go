@@ -0,0 +1,48 @@
+package command
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/newsdev/context/backend"
+	"github.com/newsdev/context/crypter"
+)
+
+func TestExportCommand(t *testing.T) {
+	keyPath, c := writeTestKey(t, "std")
+
+	b, err := backend.NewBackend("memory", "context", "TestExportCommand")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for variable, value := range map[string]string{"A": "1", "B": "two words"} {
+		encryptedValue, err := crypter.EncryptAndSignWithData(c, []byte(value), crypter.AssociatedData("context", "testgroup", variable))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := b.SetVariable("testgroup", variable, encryptedValue); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	args := []string{"-backend", "memory", "-a", "TestExportCommand", "-k", keyPath, "-g", "testgroup"}
+	e := &ExportCommand{}
+
+	var status int
+	output := captureStdout(t, func() { status = e.Run(args) })
+	if status != 0 {
+		t.Fatalf("expected exit status 0 but found %d!", status)
+	}
+	if expected := "A=1\nB='two words'\n"; output != expected {
+		t.Errorf("expected %q but found %q!", expected, output)
+	}
+
+	outputPath := filepath.Join(filepath.Dir(keyPath), "env.sh")
+	if status := e.Run(append(args, "-format", "shell", "-o", outputPath)); status != 0 {
+		t.Fatalf("expected exit status 0 but found %d!", status)
+	}
+
+	expectFile(t, outputPath, []byte("export A='1'\nexport B='two words'\n"))
+}
@@ -0,0 +1,118 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileSuffix is added to a variable's name to form the name of the variable
+// holding the path of the file it was written to.
+const FileSuffix = "_FILE"
+
+// secretFilesBase returns the directory that secret files are written under,
+// preferring /dev/shm, which is memory-backed on Linux, so that values are
+// never written to disk.
+func secretFilesBase() string {
+	if stat, err := os.Stat("/dev/shm"); err == nil && stat.IsDir() {
+		return "/dev/shm"
+	}
+	return os.TempDir()
+}
+
+// newSecretFilesDir creates a new private directory under base for secret
+// files, owned by the user of cred if it's not nil. The caller must remove
+// it.
+func newSecretFilesDir(base string, cred *credential) (string, error) {
+	dir, err := ioutil.TempDir(base, "context-")
+	if err != nil {
+		return "", err
+	}
+
+	if cred != nil {
+		if err := os.Chown(dir, cred.Uid, cred.Gid); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+
+	return dir, nil
+}
+
+// checkFileName rejects variable names that can't be used safely as the name
+// of a file in the secrets directory. Names beginning with a dot are reserved
+// for temporary files.
+func checkFileName(name string) error {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, "/\x00") {
+		return fmt.Errorf("command: invalid secret file name \"%s\"", name)
+	}
+	return nil
+}
+
+// updateSecretFiles writes each variable in env to its own file in dir,
+// readable only by its owner, and removes the files of any other variables.
+// Files are replaced atomically, so a reader sees either the old value or the
+// new one. It returns the path of each file.
+func updateSecretFiles(dir string, env map[string]string, cred *credential) (map[string]string, error) {
+	for variable := range env {
+		if err := checkFileName(variable); err != nil {
+			return nil, err
+		}
+	}
+
+	files := make(map[string]string, len(env))
+	for variable, value := range env {
+		path := filepath.Join(dir, variable)
+		tmpPath := filepath.Join(dir, ".tmp-"+variable)
+
+		// Create the file with its final permissions so that the value is
+		// never readable by anyone else, even briefly.
+		os.Remove(tmpPath)
+		file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0400)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := file.WriteString(value); err != nil {
+			file.Close()
+			os.Remove(tmpPath)
+			return nil, err
+		}
+
+		if err := file.Close(); err != nil {
+			os.Remove(tmpPath)
+			return nil, err
+		}
+
+		if cred != nil {
+			if err := os.Chown(tmpPath, cred.Uid, cred.Gid); err != nil {
+				os.Remove(tmpPath)
+				return nil, err
+			}
+		}
+
+		if err := os.Rename(tmpPath, path); err != nil {
+			os.Remove(tmpPath)
+			return nil, err
+		}
+
+		files[variable] = path
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, info := range infos {
+		if _, ok := files[info.Name()]; !ok && !strings.HasPrefix(info.Name(), ".") {
+			if err := os.Remove(filepath.Join(dir, info.Name())); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return files, nil
+}
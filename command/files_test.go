@@ -0,0 +1,100 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateSecretFiles(t *testing.T) {
+	base, err := ioutil.TempDir("", "context-command")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	dir, err := newSecretFilesDir(base, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := updateSecretFiles(dir, map[string]string{"A": "0", "B": "removed"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Updating replaces the files in place and removes those no longer
+	// needed.
+	files, err = updateSecretFiles(dir, map[string]string{"A": "1", "TLS_KEY": "-----BEGIN KEY-----\n"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 {
+		t.Errorf("expected 2 files but found %d!", len(infos))
+	}
+
+	if stat, err := os.Stat(dir); err != nil {
+		t.Fatal(err)
+	} else if mode := stat.Mode().Perm(); mode != 0700 {
+		t.Errorf("expected directory mode 0700 but found %o!", mode)
+	}
+
+	for variable, expected := range map[string]string{"A": "1", "TLS_KEY": "-----BEGIN KEY-----\n"} {
+		path := files[variable]
+		if path != filepath.Join(dir, variable) {
+			t.Errorf("%s: unexpected path %s!", variable, path)
+		}
+
+		stat, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := stat.Mode().Perm(); mode != 0400 {
+			t.Errorf("%s: expected mode 0400 but found %o!", variable, mode)
+		}
+
+		value, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(value) != expected {
+			t.Errorf("%s: expected %q but found %q!", variable, expected, value)
+		}
+	}
+}
+
+func TestUpdateSecretFilesInvalidName(t *testing.T) {
+	base, err := ioutil.TempDir("", "context-command")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	dir, err := newSecretFilesDir(base, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, variable := range []string{"", "../A", "A/B", "..", ".A", "A\x00B"} {
+		if _, err := updateSecretFiles(dir, map[string]string{"B": "0", variable: "1"}, nil); err == nil {
+			t.Errorf("%q: expected an error!", variable)
+		}
+	}
+
+	// Nothing is written, inside the directory or out of it.
+	for _, path := range []string{dir, base} {
+		infos, err := ioutil.ReadDir(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := map[string]int{dir: 0, base: 1}[path]; len(infos) != expected {
+			t.Errorf("%s: expected %d files but found %d!", path, expected, len(infos))
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"unicode/utf8"
+
+	"github.com/newsdev/context/backend"
+	"github.com/newsdev/context/crypter"
+	"github.com/newsdev/context/options"
+)
+
+type GetCommand struct{}
+
+func (s *GetCommand) Run(args []string) int {
+	var keyPath, group, outputPath, crypterType, backendType, backendAddress, backendNamespace string
+	var newline, raw bool
+	flagArgs := newOptionFlags("get")
+	flagArgs.Option(&backendAddress, "a", options.Address, "backend address")
+	flagArgs.Option(&backendNamespace, "n", options.Namespace, "backend namespace prefix")
+	flagArgs.DeprecatedProtocol()
+	flagArgs.Option(&backendType, "backend", options.Backend, "backend to use")
+	flagArgs.Option(&crypterType, "crypter", options.Crypter, "crypter to use for values without an envelope")
+	flagArgs.Option(&group, "g", options.Group, "group")
+	flagArgs.Option(&keyPath, "k", options.KeyPath, "path to a key file")
+	flagArgs.BoolVar(&newline, "newline", false, "print a trailing newline after the value")
+	flagArgs.BoolVar(&raw, "raw", false, "print the value even if it contains binary data")
+	flagArgs.StringVar(&outputPath, "o", "", "write the value to a file with mode 0600 instead")
+	if err := flagArgs.Parse(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if flagArgs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "exactly one variable must be given")
+		return 1
+	}
+	variable := flagArgs.Arg(0)
+
+	// Read the key, checking its permissions.
+	key, err := crypter.ReadKey(keyPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	c, err := crypter.NewEnvelopeReader(crypterType, key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	b, err := backend.NewBackend(backendType, backendNamespace, backendAddress)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	encryptedValue, err := b.GetVariable(group, variable)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	value, err := crypter.ValidateAndDecryptWithData(c, encryptedValue, crypter.AssociatedData(b.Namespace(), group, variable))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", variable, err)
+		return 1
+	}
+
+	if newline {
+		value = append(value, '\n')
+	}
+
+	if outputPath != "" {
+		if err := writePrivateFile(outputPath, value); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	// Avoid dumping binary data onto a terminal unless it was asked for.
+	if !raw && isBinary(value) {
+		fmt.Fprintf(os.Stderr, "%s: value contains binary data, use -raw or -o to output it\n", variable)
+		return 1
+	}
+
+	if _, err := os.Stdout.Write(value); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
+
+// isBinary reports whether value is not printable UTF-8 text.
+func isBinary(value []byte) bool {
+	return !utf8.Valid(value) || bytes.IndexByte(value, 0) >= 0
+}
+
+// writePrivateFile writes data to the file at path, which is readable only by
+// its owner. Permissions are set before anything is written, including when
+// an existing file is replaced.
+func writePrivateFile(path string, data []byte) error {
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := out.Chmod(0600); err != nil {
+		out.Close()
+		return err
+	}
+
+	if _, err := out.Write(data); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+func (s *GetCommand) Help() string { return "" }
+
+func (s *GetCommand) Synopsis() string { return "" }
@@ -0,0 +1,227 @@
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/newsdev/context/backend"
+	"github.com/newsdev/context/crypter"
+)
+
+func TestGetCommand(t *testing.T) {
+	keyPath, c := writeTestKey(t, "gcm")
+
+	b, err := backend.NewBackend("memory", "context", "TestGetCommand")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string][]byte{
+		"TEXT":   []byte("password"),
+		"BINARY": []byte{0x30, 0x82, 0x00, 0x00},
+	}
+	for variable, value := range values {
+		encryptedValue, err := crypter.EncryptAndSignWithData(c, value, crypter.AssociatedData("context", "testgroup", variable))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := b.SetVariable("testgroup", variable, encryptedValue); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir := filepath.Dir(keyPath)
+	args := []string{"-backend", "memory", "-a", "TestGetCommand", "-k", keyPath, "-g", "testgroup"}
+	g := &GetCommand{}
+
+	outputPath := filepath.Join(dir, "text")
+	if status := g.Run(append(args, "-newline", "-o", outputPath, "TEXT")); status != 0 {
+		t.Fatalf("expected exit status 0 but found %d!", status)
+	}
+
+	expectFile(t, outputPath, []byte("password\n"))
+
+	// Binary values are only written to stdout with -raw, but can always be
+	// written to a file.
+	if status := g.Run(append(args, "BINARY")); status == 0 {
+		t.Error("expected binary output to be refused!")
+	}
+
+	outputPath = filepath.Join(dir, "binary")
+	if status := g.Run(append(args, "-o", outputPath, "BINARY")); status != 0 {
+		t.Fatalf("expected exit status 0 but found %d!", status)
+	}
+
+	expectFile(t, outputPath, values["BINARY"])
+
+	if status := g.Run(append(args, "MISSING")); status == 0 {
+		t.Error("expected an error for a missing variable!")
+	}
+}
+
+// fakeRedis serves, from memory, the hash commands that the redis backend
+// uses, so that commands can be tested with redis:// URIs.
+type fakeRedis struct {
+	mu     sync.Mutex
+	hashes map[string]map[string]string
+}
+
+func (f *fakeRedis) serve(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go f.serveConn(conn)
+	}
+}
+
+func (f *fakeRedis) serveConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		command, err := readRedisCommand(r)
+		if err != nil {
+			return
+		}
+
+		f.mu.Lock()
+		hash := f.hashes[command[1]]
+		if hash == nil {
+			hash = make(map[string]string)
+			f.hashes[command[1]] = hash
+		}
+
+		var reply bytes.Buffer
+		switch command[0] {
+		case "HGET":
+			if value, ok := hash[command[2]]; ok {
+				fmt.Fprintf(&reply, "$%d\r\n%s\r\n", len(value), value)
+			} else {
+				reply.WriteString("$-1\r\n")
+			}
+		case "HGETALL":
+			fmt.Fprintf(&reply, "*%d\r\n", 2*len(hash))
+			for field, value := range hash {
+				fmt.Fprintf(&reply, "$%d\r\n%s\r\n$%d\r\n%s\r\n", len(field), field, len(value), value)
+			}
+		case "HMSET":
+			for i := 2; i+1 < len(command); i += 2 {
+				hash[command[i]] = command[i+1]
+			}
+			reply.WriteString("+OK\r\n")
+		default:
+			fmt.Fprintf(&reply, "-ERR unknown command %s\r\n", command[0])
+		}
+		f.mu.Unlock()
+
+		conn.Write(reply.Bytes())
+	}
+}
+
+func readRedisCommand(r *bufio.Reader) ([]string, error) {
+	var n int
+	if _, err := fmt.Fscanf(r, "*%d\r\n", &n); err != nil {
+		return nil, err
+	}
+
+	command := make([]string, n)
+	for i := range command {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		size, err := strconv.Atoi(line[1 : len(line)-2])
+		if err != nil {
+			return nil, err
+		}
+
+		arg := make([]byte, size+2)
+		if _, err := io.ReadFull(r, arg); err != nil {
+			return nil, err
+		}
+		command[i] = string(arg[:size])
+	}
+
+	return command, nil
+}
+
+// TestGetCommandURINamespace checks that a namespace given in a backend URI
+// and the same namespace given with -n reach the same values, which gcm
+// binds to the namespace they're stored under.
+func TestGetCommandURINamespace(t *testing.T) {
+	keyPath, _ := writeTestKey(t, "gcm")
+
+	f := &fakeRedis{hashes: make(map[string]map[string]string)}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go f.serve(l)
+
+	dir := filepath.Dir(keyPath)
+	valuePath := filepath.Join(dir, "value")
+	if err := ioutil.WriteFile(valuePath, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	uriArgs := []string{"-a", fmt.Sprintf("redis://%s?namespace=staging", l.Addr()), "-crypter", "gcm", "-k", keyPath, "-g", "app"}
+	flagArgs := []string{"-backend", "redis", "-a", l.Addr().String(), "-n", "staging", "-crypter", "gcm", "-k", keyPath, "-g", "app"}
+
+	for _, args := range [][][]string{{uriArgs, flagArgs}, {flagArgs, uriArgs}} {
+		setArgs, getArgs := args[0], args[1]
+
+		var status int
+		captureStdout(t, func() { status = (&SetCommand{}).Run(append(setArgs, "-f", valuePath, "A")) })
+		if status != 0 {
+			t.Fatalf("expected exit status 0 but found %d!", status)
+		}
+
+		outputPath := filepath.Join(dir, "output")
+		os.Remove(outputPath)
+		if status := (&GetCommand{}).Run(append(getArgs, "-o", outputPath, "A")); status != 0 {
+			t.Fatalf("expected exit status 0 but found %d!", status)
+		}
+
+		expectFile(t, outputPath, []byte("secret"))
+	}
+
+	f.mu.Lock()
+	if _, ok := f.hashes["staging:app"]["A"]; !ok {
+		t.Error("expected A to be stored in the staging namespace!")
+	}
+	f.mu.Unlock()
+}
+
+// expectFile checks the contents and permissions of the file at path.
+func expectFile(t *testing.T, path string, expected []byte) {
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("expected file mode 0600 but found %o!", mode)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(content, expected) {
+		t.Errorf("expected %q but found %q!", expected, content)
+	}
+}
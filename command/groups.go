@@ -0,0 +1,104 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/newsdev/context/agent"
+	"github.com/newsdev/context/backend"
+	"github.com/newsdev/context/crypter"
+)
+
+// groupList is a flag that may be repeated, or given a comma-separated list,
+// to name several groups in order.
+type groupList []string
+
+func (g *groupList) String() string {
+	return strings.Join(*g, ",")
+}
+
+func (g *groupList) Set(value string) error {
+	for _, group := range strings.Split(value, ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			*g = append(*g, group)
+		}
+	}
+	return nil
+}
+
+// backendSource provides decrypted groups straight from a backend. It is
+// what the agent serves, and what exec uses without one.
+type backendSource struct {
+	backend backend.Backend
+	crypter crypter.Crypter
+}
+
+func (s *backendSource) GetGroup(group string) (map[string]string, error) {
+	encryptedEnv, err := s.backend.GetGroup(group)
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := decryptGroup(s.crypter, s.backend.Namespace(), group, encryptedEnv)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", group, err)
+	}
+
+	return env, nil
+}
+
+func (s *backendSource) WatchGroup(group string, changes chan<- string, started chan<- struct{}, stop <-chan bool) error {
+	return s.backend.WatchGroup(group, changes, started, stop)
+}
+
+// layeredEnv is the result of merging several groups, recording for each
+// variable the groups that set it, in order. The last one wins.
+type layeredEnv struct {
+	Env     map[string]string
+	Sources map[string][]string
+}
+
+// mergeGroups reads each group in turn and merges them, so that values in
+// later groups override those in earlier ones.
+func mergeGroups(source agent.Source, groups []string) (*layeredEnv, error) {
+	layered := &layeredEnv{
+		Env:     make(map[string]string),
+		Sources: make(map[string][]string),
+	}
+
+	for _, group := range groups {
+		env, err := source.GetGroup(group)
+		if err != nil {
+			return nil, err
+		}
+
+		for variable, value := range env {
+			layered.Env[variable] = value
+			layered.Sources[variable] = append(layered.Sources[variable], group)
+		}
+	}
+
+	return layered, nil
+}
+
+// writeSources reports where each variable came from, and which groups it
+// overrode, in order of name.
+func (l *layeredEnv) writeSources(w io.Writer) {
+	variables := make([]string, 0, len(l.Sources))
+	for variable := range l.Sources {
+		variables = append(variables, variable)
+	}
+	sort.Strings(variables)
+
+	for _, variable := range variables {
+		sources := l.Sources[variable]
+		winner := sources[len(sources)-1]
+		if len(sources) == 1 {
+			fmt.Fprintf(w, "%s: %s\n", variable, winner)
+		} else {
+			fmt.Fprintf(w, "%s: %s (overrides %s)\n", variable, winner, strings.Join(sources[:len(sources)-1], ", "))
+		}
+	}
+}
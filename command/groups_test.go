@@ -0,0 +1,80 @@
+package command
+
+import (
+	"bytes"
+	"flag"
+	"reflect"
+	"testing"
+
+	"github.com/newsdev/context/backend"
+	"github.com/newsdev/context/crypter"
+)
+
+func TestGroupList(t *testing.T) {
+	var groups groupList
+	flagArgs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagArgs.Var(&groups, "g", "")
+	if err := flagArgs.Parse([]string{"-g", "shared", "-g", "app, app-production"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := (groupList{"shared", "app", "app-production"}); !reflect.DeepEqual(groups, expected) {
+		t.Errorf("expected %q but found %q!", expected, groups)
+	}
+}
+
+func TestMergeGroups(t *testing.T) {
+	_, c := writeTestKey(t, "gcm")
+
+	b, err := backend.NewBackend("memory", "context", "TestMergeGroups")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for group, env := range map[string]map[string]string{
+		"shared":         {"A": "shared", "B": "shared", "C": "shared"},
+		"app":            {"B": "app", "C": "app"},
+		"app-production": {"C": "app-production", "D": "app-production"},
+	} {
+		for variable, value := range env {
+			encryptedValue, err := crypter.EncryptAndSignWithData(c, []byte(value), crypter.AssociatedData("context", group, variable))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := b.SetVariable(group, variable, encryptedValue); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	layered, err := mergeGroups(&backendSource{b, c}, []string{"shared", "app", "app-production"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{"A": "shared", "B": "app", "C": "app-production", "D": "app-production"}
+	if !reflect.DeepEqual(layered.Env, expected) {
+		t.Errorf("expected %q but found %q!", expected, layered.Env)
+	}
+
+	var buf bytes.Buffer
+	layered.writeSources(&buf)
+	if expected := "A: shared\nB: app (overrides shared)\nC: app-production (overrides shared, app)\nD: app-production\n"; buf.String() != expected {
+		t.Errorf("expected %q but found %q!", expected, buf.String())
+	}
+
+	// A value can't be moved from one group to another.
+	encryptedValue, err := b.GetVariable("shared", "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.SetVariable("app", "A", encryptedValue); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := mergeGroups(&backendSource{b, c}, []string{"shared", "app"}); err == nil {
+		t.Error("expected a value moved between groups to fail!")
+	}
+}
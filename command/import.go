@@ -0,0 +1,164 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/newsdev/context/backend"
+	"github.com/newsdev/context/crypter"
+	"github.com/newsdev/context/envfile"
+	"github.com/newsdev/context/options"
+)
+
+type ImportCommand struct{}
+
+func (s *ImportCommand) Run(args []string) int {
+	var keyPath, group, format, existing, crypterType, backendType, backendAddress, backendNamespace string
+	flagArgs := newOptionFlags("import")
+	flagArgs.Option(&backendAddress, "a", options.Address, "backend address")
+	flagArgs.Option(&backendNamespace, "n", options.Namespace, "backend namespace prefix")
+	flagArgs.DeprecatedProtocol()
+	flagArgs.Option(&backendType, "backend", options.Backend, "backend to use")
+	flagArgs.Option(&crypterType, "crypter", options.Crypter, "crypter to use")
+	flagArgs.Option(&group, "g", options.Group, "group")
+	flagArgs.Option(&keyPath, "k", options.KeyPath, "path to a key file")
+	flagArgs.StringVar(&format, "format", "", "input format: dotenv or json (default based on the file name)")
+	flagArgs.StringVar(&existing, "existing", "fail", "what to do with variables that are already set: skip, overwrite or fail")
+	if err := flagArgs.Parse(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if existing != "skip" && existing != "overwrite" && existing != "fail" {
+		fmt.Fprintf(os.Stderr, "unknown value \"%s\" for -existing\n", existing)
+		return 1
+	}
+
+	if flagArgs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "exactly one file must be given, or - for standard input")
+		return 1
+	}
+	path := flagArgs.Arg(0)
+
+	if format == "" {
+		format = envfile.FormatForPath(path)
+	}
+
+	var input io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer file.Close()
+		input = file
+	}
+
+	env, err := envfile.Parse(input, format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// Read the key, checking its permissions.
+	key, err := crypter.ReadKey(keyPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	c, err := crypter.NewEnvelopeCrypter(crypterType, key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	b, err := backend.NewBackend(backendType, backendNamespace, backendAddress)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	encryptedEnv, err := b.GetGroup(group)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	variables := make([]string, 0, len(env))
+	for variable := range env {
+		variables = append(variables, variable)
+	}
+	sort.Strings(variables)
+
+	// Check for conflicts before writing anything, so that a failed import
+	// doesn't leave the group half changed.
+	if existing == "fail" {
+		conflicts := 0
+		for _, variable := range variables {
+			if _, ok := encryptedEnv[variable]; ok {
+				fmt.Fprintf(os.Stderr, "%s: already set\n", variable)
+				conflicts++
+			}
+		}
+
+		if conflicts > 0 {
+			fmt.Fprintf(os.Stderr, "%d variables are already set, use -existing to skip or overwrite them\n", conflicts)
+			return 1
+		}
+	}
+
+	var added, updated, unchanged, skipped int
+	for _, variable := range variables {
+		value := []byte(env[variable])
+		data := crypter.AssociatedData(b.Namespace(), group, variable)
+
+		status := "added"
+		if encryptedValue, ok := encryptedEnv[variable]; ok {
+			if existing == "skip" {
+				fmt.Printf("%s: skipped\n", variable)
+				skipped++
+				continue
+			}
+
+			// Leave values that wouldn't change alone, unless they're stored
+			// in an older format.
+			if current, err := crypter.ValidateAndDecryptWithData(c, encryptedValue, data); err == nil && bytes.Equal(current, value) && crypter.Current(c, encryptedValue) {
+				fmt.Printf("%s: unchanged\n", variable)
+				unchanged++
+				continue
+			}
+
+			status = "updated"
+		}
+
+		encryptedValue, err := crypter.EncryptAndSignWithData(c, value, data)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		if err := b.SetVariable(group, variable, encryptedValue); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		fmt.Printf("%s: %s\n", variable, status)
+		if status == "added" {
+			added++
+		} else {
+			updated++
+		}
+	}
+
+	fmt.Printf("added %d, updated %d, unchanged %d, skipped %d\n", added, updated, unchanged, skipped)
+	return 0
+}
+
+func (s *ImportCommand) Help() string { return "" }
+
+func (s *ImportCommand) Synopsis() string { return "" }
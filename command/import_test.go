@@ -0,0 +1,66 @@
+package command
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/newsdev/context/backend"
+	"github.com/newsdev/context/crypter"
+)
+
+func TestImportCommand(t *testing.T) {
+	keyPath, c := writeTestKey(t, "gcm")
+
+	b, err := backend.NewBackend("memory", "context", "TestImportCommand")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encryptedValue, err := crypter.EncryptAndSignWithData(c, []byte("old"), crypter.AssociatedData("context", "testgroup", "A"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.SetVariable("testgroup", "A", encryptedValue); err != nil {
+		t.Fatal(err)
+	}
+
+	envPath := filepath.Join(filepath.Dir(keyPath), ".env")
+	if err := ioutil.WriteFile(envPath, []byte("export A=new\nB=\"multi\nline\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{"-backend", "memory", "-a", "TestImportCommand", "-crypter", "gcm", "-k", keyPath, "-g", "testgroup"}
+	i := &ImportCommand{}
+
+	// By default an existing variable stops the import before anything is
+	// written.
+	var status int
+	captureStdout(t, func() { status = i.Run(append(args, envPath)) })
+	if status == 0 {
+		t.Error("expected an existing variable to fail the import!")
+	}
+
+	expectGroupValues(t, b, c, "testgroup", map[string]string{"A": "old"})
+
+	output := captureStdout(t, func() { status = i.Run(append(args, "-existing", "skip", envPath)) })
+	if status != 0 {
+		t.Fatalf("expected exit status 0 but found %d!", status)
+	}
+	if expected := "A: skipped\nB: added\nadded 1, updated 0, unchanged 0, skipped 1\n"; output != expected {
+		t.Errorf("expected %q but found %q!", expected, output)
+	}
+
+	expectGroupValues(t, b, c, "testgroup", map[string]string{"A": "old", "B": "multi\nline"})
+
+	output = captureStdout(t, func() { status = i.Run(append(args, "-existing", "overwrite", envPath)) })
+	if status != 0 {
+		t.Fatalf("expected exit status 0 but found %d!", status)
+	}
+	if expected := "A: updated\nB: unchanged\nadded 0, updated 1, unchanged 1, skipped 0\n"; output != expected {
+		t.Errorf("expected %q but found %q!", expected, output)
+	}
+
+	expectGroupValues(t, b, c, "testgroup", map[string]string{"A": "new", "B": "multi\nline"})
+}
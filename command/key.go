@@ -1,11 +1,11 @@
 package command
 
 import (
-	"flag"
 	"fmt"
 	"os"
 
 	"github.com/newsdev/context/crypter"
+	"github.com/newsdev/context/options"
 )
 
 type KeyCommand struct {
@@ -15,9 +15,9 @@ type KeyCommand struct {
 
 func (s *KeyCommand) Run(args []string) int {
 	var keyPath, crypterType string
-	flagArgs := flag.NewFlagSet("key", flag.ContinueOnError)
-	flagArgs.StringVar(&crypterType, "crypter", "std", "crypter to use")
-	flagArgs.StringVar(&keyPath, "k", "/etc/context/key", "path to save the key file to")
+	flagArgs := newOptionFlags("key")
+	flagArgs.Option(&crypterType, "crypter", options.Crypter, "crypter to use")
+	flagArgs.Option(&keyPath, "k", options.KeyPath, "path to save the key file to")
 	if err := flagArgs.Parse(args); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return 1
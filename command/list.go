@@ -0,0 +1,65 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/newsdev/context/backend"
+	"github.com/newsdev/context/options"
+)
+
+type ListCommand struct{}
+
+func (s *ListCommand) Run(args []string) int {
+	var group, backendType, backendAddress, backendNamespace string
+	flagArgs := newOptionFlags("list")
+	flagArgs.Option(&backendAddress, "a", options.Address, "backend address")
+	flagArgs.Option(&backendNamespace, "n", options.Namespace, "backend namespace prefix")
+	flagArgs.DeprecatedProtocol()
+	flagArgs.Option(&backendType, "backend", options.Backend, "backend to use")
+	flagArgs.StringVar(&group, "g", "", "list the variables in this group rather than the groups")
+	if err := flagArgs.Parse(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	b, err := backend.NewBackend(backendType, backendNamespace, backendAddress)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var names []string
+	if group == "" {
+		names, err = b.ListGroups()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	} else {
+
+		// Only the names are needed, so nothing is decrypted and no key is
+		// required.
+		encryptedEnv, err := b.GetGroup(group)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		for variable := range encryptedEnv {
+			names = append(names, variable)
+		}
+		sort.Strings(names)
+	}
+
+	for _, name := range names {
+		fmt.Println(name)
+	}
+
+	return 0
+}
+
+func (s *ListCommand) Help() string { return "" }
+
+func (s *ListCommand) Synopsis() string { return "" }
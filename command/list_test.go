@@ -0,0 +1,66 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/newsdev/context/backend"
+)
+
+// captureStdout returns whatever f writes to standard output.
+func captureStdout(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan []byte)
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		output <- b
+	}()
+
+	f()
+	w.Close()
+	return string(<-output)
+}
+
+func TestListCommand(t *testing.T) {
+	b, err := backend.NewBackend("memory", "context", "TestListCommand")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, group := range []string{"web", "worker"} {
+		for _, variable := range []string{"B", "A"} {
+			if err := b.SetVariable(group, variable, []byte("not even encrypted")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	args := []string{"-backend", "memory", "-a", "TestListCommand"}
+	l := &ListCommand{}
+
+	var status int
+	output := captureStdout(t, func() { status = l.Run(args) })
+	if status != 0 {
+		t.Fatalf("expected exit status 0 but found %d!", status)
+	}
+	if output != "web\nworker\n" {
+		t.Errorf("expected groups web and worker but found %q!", output)
+	}
+
+	output = captureStdout(t, func() { status = l.Run(append(args, "-g", "web")) })
+	if status != 0 {
+		t.Fatalf("expected exit status 0 but found %d!", status)
+	}
+	if output != "A\nB\n" {
+		t.Errorf("expected variables A and B but found %q!", output)
+	}
+}
@@ -0,0 +1,110 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/newsdev/context/backend"
+	"github.com/newsdev/context/crypter"
+	"github.com/newsdev/context/options"
+)
+
+type MigrateCommand struct{}
+
+func (s *MigrateCommand) Run(args []string) int {
+	var keyPath, group, crypterType, backendType, backendAddress, backendNamespace string
+	var dryRun bool
+	flagArgs := newOptionFlags("migrate")
+	flagArgs.Option(&backendAddress, "a", options.Address, "backend address")
+	flagArgs.Option(&backendNamespace, "n", options.Namespace, "backend namespace prefix")
+	flagArgs.DeprecatedProtocol()
+	flagArgs.Option(&backendType, "backend", options.Backend, "backend to use")
+	flagArgs.Option(&crypterType, "crypter", options.Crypter, "crypter to use")
+	flagArgs.Option(&group, "g", options.Group, "group")
+	flagArgs.Option(&keyPath, "k", options.KeyPath, "path to a key file")
+	flagArgs.BoolVar(&dryRun, "dry-run", false, "report outdated variables without rewriting them")
+	if err := flagArgs.Parse(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// Read the key, checking its permissions.
+	key, err := crypter.ReadKey(keyPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// Use the key to create a new crypter of the given type.
+	c, err := crypter.NewEnvelopeCrypter(crypterType, key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	b, err := backend.NewBackend(backendType, backendNamespace, backendAddress)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	encryptedEnv, err := b.GetGroup(group)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// Migrate the named variables, or the whole group if none are given.
+	variables := flagArgs.Args()
+	if len(variables) == 0 {
+		for variable := range encryptedEnv {
+			variables = append(variables, variable)
+		}
+		sort.Strings(variables)
+	}
+
+	for _, variable := range variables {
+		encryptedValue, ok := encryptedEnv[variable]
+		if !ok {
+			fmt.Fprintln(os.Stderr, backend.NoVariableError{Group: group, Variable: variable})
+			return 1
+		}
+
+		if !crypter.Outdated(c, encryptedValue) {
+			continue
+		}
+
+		if dryRun {
+			fmt.Printf("%s: outdated\n", variable)
+			continue
+		}
+
+		// Rewriting the value with the same crypter uses its current format.
+		data := crypter.AssociatedData(b.Namespace(), group, variable)
+		value, err := crypter.ValidateAndDecryptWithData(c, encryptedValue, data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", variable, err)
+			return 1
+		}
+
+		encryptedValue, err = crypter.EncryptAndSignWithData(c, value, data)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		if err := b.SetVariable(group, variable, encryptedValue); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		fmt.Printf("%s: migrated\n", variable)
+	}
+
+	return 0
+}
+
+func (s *MigrateCommand) Help() string { return "" }
+
+func (s *MigrateCommand) Synopsis() string { return "" }
@@ -0,0 +1,112 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/newsdev/context/options"
+)
+
+// optionFlags is a flag set whose shared settings fall back on the
+// environment, the configuration files and the selected profile, so that
+// every command resolves them the same way.
+type optionFlags struct {
+	*flag.FlagSet
+	profile string
+
+	// settings maps the name of each flag to the setting it falls back on,
+	// and vars records the flags defined with OptionVar.
+	settings map[string]string
+	vars     map[string]bool
+
+	// protocol records whether the deprecated -protocol flag is defined.
+	protocol bool
+}
+
+func newOptionFlags(name string) *optionFlags {
+	o := &optionFlags{
+		FlagSet:  flag.NewFlagSet(name, flag.ContinueOnError),
+		settings: make(map[string]string),
+		vars:     make(map[string]bool),
+	}
+	o.StringVar(&o.profile, "profile", "", "configuration profile to use (default $"+options.ProfileEnv+")")
+	return o
+}
+
+// Option defines a string flag for a setting, defaulting to the setting's
+// built-in default.
+func (o *optionFlags) Option(p *string, name, setting, usage string) {
+	o.StringVar(p, name, options.Defaults[setting], usage)
+	o.settings[name] = setting
+}
+
+// OptionVar defines a flag of any type for a setting. Its value is only set
+// from the setting if it comes from somewhere other than the defaults.
+func (o *optionFlags) OptionVar(value flag.Value, name, setting, usage string) {
+	o.Var(value, name, usage)
+	o.settings[name] = setting
+	o.vars[name] = true
+}
+
+// DeprecatedProtocol defines -protocol, which backend URIs have replaced. It
+// is still accepted, as a flag or a setting, so that existing scripts keep
+// working, but it has no effect and Parse warns when it's set.
+func (o *optionFlags) DeprecatedProtocol() {
+	o.String("protocol", options.DefaultProtocol, "deprecated, give the backend address as a URI instead")
+	o.protocol = true
+}
+
+// Parse parses the flags, then sets each setting's flag that wasn't given
+// from the resolved settings.
+func (o *optionFlags) Parse(args []string) error {
+	if err := o.FlagSet.Parse(args); err != nil {
+		return err
+	}
+
+	given := make(map[string]bool)
+	o.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	settings, err := options.Resolve(o.profile)
+	if err != nil {
+		return err
+	}
+
+	if o.protocol && (given["protocol"] || settings[options.Protocol] != options.DefaultProtocol) {
+		fmt.Fprintln(os.Stderr, "context: -protocol is deprecated and has no effect, give the backend address as a URI instead")
+	}
+
+	for name, setting := range o.settings {
+		if given[name] {
+			continue
+		}
+
+		value := settings[setting]
+		if o.vars[name] && value == options.Defaults[setting] {
+			continue
+		}
+
+		// Commands that read a list of groups define the group flag with
+		// OptionVar. The rest work on one group, and a list from the
+		// settings would otherwise become the name of a group.
+		if setting == options.Group && !o.vars[name] && strings.Contains(value, ",") {
+			return GroupListError{o.Name(), value}
+		}
+
+		if err := o.Set(name, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type GroupListError struct {
+	Command string
+	Groups  string
+}
+
+func (e GroupListError) Error() string {
+	return fmt.Sprintf("command: %s works on a single group, but the group setting is the list \"%s\"", e.Command, e.Groups)
+}
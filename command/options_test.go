@@ -0,0 +1,126 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/newsdev/context/options"
+)
+
+func TestMain(m *testing.M) {
+
+	// Keep the host's configuration files and CONTEXT_* variables from
+	// changing the settings the command tests run with.
+	config, err := ioutil.TempFile("", "context-config")
+	if err != nil {
+		panic(err)
+	}
+	config.Close()
+
+	options.SystemConfigPath = ""
+	for _, variable := range os.Environ() {
+		if strings.HasPrefix(variable, options.EnvPrefix) {
+			os.Unsetenv(strings.SplitN(variable, "=", 2)[0])
+		}
+	}
+	os.Setenv(options.ConfigEnv, config.Name())
+
+	status := m.Run()
+	os.Remove(config.Name())
+	os.Exit(status)
+}
+
+func TestOptionFlags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "context-command")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "config")
+	config := "backend = file\nnamespace = configured\n\n[staging]\naddress = /var/lib/staging\ngroup = app, shared\n"
+	if err := ioutil.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Setenv(options.ConfigEnv, os.Getenv(options.ConfigEnv))
+	os.Setenv(options.ConfigEnv, configPath)
+	os.Setenv("CONTEXT_NAMESPACE", "environment")
+	defer os.Unsetenv("CONTEXT_NAMESPACE")
+
+	var backendType, backendAddress, backendNamespace, crypterType string
+	var groups groupList
+	flagArgs := newOptionFlags("test")
+	flagArgs.Option(&backendType, "backend", options.Backend, "")
+	flagArgs.Option(&backendAddress, "a", options.Address, "")
+	flagArgs.Option(&backendNamespace, "n", options.Namespace, "")
+	flagArgs.Option(&crypterType, "crypter", options.Crypter, "")
+	flagArgs.OptionVar(&groups, "g", options.Group, "")
+	if err := flagArgs.Parse([]string{"-profile", "staging", "-crypter", "gcm"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Flags win over the environment, which wins over the profile and the
+	// file, which win over the defaults.
+	for found, expected := range map[*string]string{
+		&backendType:      "file",
+		&backendAddress:   "/var/lib/staging",
+		&backendNamespace: "environment",
+		&crypterType:      "gcm",
+	} {
+		if *found != expected {
+			t.Errorf("expected %q but found %q!", expected, *found)
+		}
+	}
+
+	if expected := (groupList{"app", "shared"}); !reflect.DeepEqual(groups, expected) {
+		t.Errorf("expected %q but found %q!", expected, groups)
+	}
+
+	// Without a profile, a list of groups isn't filled in with the default.
+	groups = nil
+	flagArgs = newOptionFlags("test")
+	flagArgs.OptionVar(&groups, "g", options.Group, "")
+	if err := flagArgs.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 0 {
+		t.Errorf("expected no groups but found %q!", groups)
+	}
+
+	flagArgs = newOptionFlags("test")
+	if err := flagArgs.Parse([]string{"-profile", "production"}); err == nil {
+		t.Error("expected an error for an unknown profile!")
+	}
+
+	// The deprecated -protocol is still accepted.
+	flagArgs = newOptionFlags("test")
+	flagArgs.DeprecatedProtocol()
+	if err := flagArgs.Parse([]string{"-protocol", "tcp"}); err != nil {
+		t.Error(err)
+	}
+
+	// A command that works on one group refuses a list from the settings,
+	// but not a single group given as a flag.
+	var group string
+	flagArgs = newOptionFlags("test")
+	flagArgs.Option(&group, "g", options.Group, "")
+	if err := flagArgs.Parse([]string{"-profile", "staging"}); err == nil {
+		t.Error("expected an error for a list of groups!")
+	} else if _, ok := err.(GroupListError); !ok {
+		t.Errorf("expected a GroupListError but found %T!", err)
+	}
+
+	flagArgs = newOptionFlags("test")
+	flagArgs.Option(&group, "g", options.Group, "")
+	if err := flagArgs.Parse([]string{"-profile", "staging", "-g", "app"}); err != nil {
+		t.Error(err)
+	}
+	if group != "app" {
+		t.Errorf("expected \"app\" but found %q!", group)
+	}
+}
@@ -0,0 +1,189 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/newsdev/context/backend"
+	"github.com/newsdev/context/crypter"
+	"github.com/newsdev/context/options"
+)
+
+type RotateCommand struct{}
+
+func (s *RotateCommand) Run(args []string) int {
+	var keyPath, newKeyPath, group, crypterType, newCrypterType, backendType, backendAddress, backendNamespace string
+	var all, dryRun bool
+	flagArgs := newOptionFlags("rotate")
+	flagArgs.Option(&backendAddress, "a", options.Address, "backend address")
+	flagArgs.Option(&backendNamespace, "n", options.Namespace, "backend namespace prefix")
+	flagArgs.DeprecatedProtocol()
+	flagArgs.Option(&backendType, "backend", options.Backend, "backend to use")
+	flagArgs.Option(&crypterType, "crypter", options.Crypter, "crypter of the old key, for values without an envelope")
+	flagArgs.Option(&newCrypterType, "new-crypter", options.Crypter, "crypter of the new key")
+	flagArgs.Option(&group, "g", options.Group, "group")
+	flagArgs.BoolVar(&all, "all", false, "rotate every group in the namespace")
+	flagArgs.Option(&keyPath, "k", options.KeyPath, "path to the old key file")
+	flagArgs.StringVar(&newKeyPath, "new-k", "", "path to the new key file")
+	flagArgs.BoolVar(&dryRun, "dry-run", false, "report what would be rotated without writing anything")
+	if err := flagArgs.Parse(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if newKeyPath == "" {
+		fmt.Fprintln(os.Stderr, "a new key file must be given with -new-k")
+		return 1
+	}
+
+	// Read both keys, checking their permissions.
+	key, err := crypter.ReadKey(keyPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	newKey, err := crypter.ReadKey(newKeyPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if bytes.Equal(key, newKey) {
+		fmt.Fprintln(os.Stderr, "the old and new keys are the same")
+		return 1
+	}
+
+	c, err := crypter.NewEnvelopeReader(crypterType, key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	newC, err := crypter.NewEnvelopeCrypter(newCrypterType, newKey)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	b, err := backend.NewBackend(backendType, backendNamespace, backendAddress)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	groups := []string{group}
+	if all {
+		groups, err = b.ListGroups()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	r := &rotation{
+		backend:  b,
+		old:      c,
+		new:      newC,
+		newKeyID: crypter.KeyID(newKey),
+		dryRun:   dryRun,
+	}
+
+	for _, group := range groups {
+		if err := r.rotateGroup(group); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Printf("rotated %d, skipped %d before stopping\n", r.rotated, r.skipped)
+			return 1
+		}
+	}
+
+	if dryRun {
+		fmt.Printf("would rotate %d, skipped %d\n", r.rotated, r.skipped)
+	} else {
+		fmt.Printf("rotated %d, skipped %d\n", r.rotated, r.skipped)
+	}
+
+	return 0
+}
+
+// A rotation re-encrypts values from an old key to a new one. Each value is
+// written back on its own, so an interrupted rotation leaves every value
+// readable with one key or the other. Values that already carry the new key's
+// ID are skipped, which makes it safe to run a rotation again to finish it.
+type rotation struct {
+	backend          backend.Backend
+	old, new         crypter.Crypter
+	newKeyID         []byte
+	dryRun           bool
+	rotated, skipped int
+}
+
+func (r *rotation) rotateGroup(group string) error {
+	encryptedEnv, err := r.backend.GetGroup(group)
+	if err != nil {
+		return err
+	}
+
+	variables := make([]string, 0, len(encryptedEnv))
+	for variable := range encryptedEnv {
+		variables = append(variables, variable)
+	}
+	sort.Strings(variables)
+
+	for _, variable := range variables {
+		done, err := r.rotateVariable(group, variable, encryptedEnv[variable])
+		if err != nil {
+			return fmt.Errorf("%s/%s: %s", group, variable, err)
+		}
+
+		switch {
+		case done:
+			r.skipped++
+			fmt.Printf("%s/%s: already rotated\n", group, variable)
+		case r.dryRun:
+			r.rotated++
+			fmt.Printf("%s/%s: would rotate\n", group, variable)
+		default:
+			r.rotated++
+			fmt.Printf("%s/%s: rotated\n", group, variable)
+		}
+	}
+
+	return nil
+}
+
+// rotateVariable re-encrypts a single value, reporting whether it had already
+// been rotated.
+func (r *rotation) rotateVariable(group, variable string, encryptedValue []byte) (bool, error) {
+	envelope, ok, err := crypter.ParseEnvelope(encryptedValue)
+	if err != nil {
+		return false, err
+	}
+
+	if ok && bytes.Equal(envelope.KeyID, r.newKeyID) {
+		return true, nil
+	}
+
+	data := crypter.AssociatedData(r.backend.Namespace(), group, variable)
+	value, err := crypter.ValidateAndDecryptWithData(r.old, encryptedValue, data)
+	if err != nil {
+		return false, err
+	}
+
+	if r.dryRun {
+		return false, nil
+	}
+
+	encryptedValue, err = crypter.EncryptAndSignWithData(r.new, value, data)
+	if err != nil {
+		return false, err
+	}
+
+	return false, r.backend.SetVariable(group, variable, encryptedValue)
+}
+
+func (s *RotateCommand) Help() string { return "" }
+
+func (s *RotateCommand) Synopsis() string { return "" }
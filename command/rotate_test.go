@@ -0,0 +1,117 @@
+package command
+
+import (
+	"os"
+	"testing"
+
+	"github.com/newsdev/context/backend"
+	"github.com/newsdev/context/crypter"
+)
+
+func TestRotateCommand(t *testing.T) {
+	keyPath, c := writeTestKey(t, "std")
+	newKeyPath, newC := writeTestKey(t, "gcm")
+
+	b, err := backend.NewBackend("memory", "context", "TestRotateCommand")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string]string{"A": "1", "B": "2"}
+	for _, group := range []string{"one", "two"} {
+		for variable, value := range values {
+			encryptedValue, err := crypter.EncryptAndSignWithData(c, []byte(value), crypter.AssociatedData("context", group, variable))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := b.SetVariable(group, variable, encryptedValue); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	args := []string{"-backend", "memory", "-a", "TestRotateCommand", "-k", keyPath, "-new-k", newKeyPath, "-new-crypter", "gcm"}
+
+	// A new key that the new crypter can't use is refused up front, even in
+	// a dry run.
+	r := &RotateCommand{}
+	stdKeyPath, _ := writeTestKey(t, "std")
+	if status := r.Run([]string{"-backend", "memory", "-a", "TestRotateCommand", "-k", keyPath, "-new-k", stdKeyPath, "-new-crypter", "gcm", "-all", "-dry-run"}); status != 1 {
+		t.Errorf("expected exit status 1 but found %d!", status)
+	}
+
+	// A dry run shouldn't change anything.
+	if status := r.Run(append(args, "-all", "-dry-run")); status != 0 {
+		t.Fatalf("expected exit status 0 but found %d!", status)
+	}
+
+	expectGroupValues(t, b, c, "one", values)
+
+	// Rotate a single group, as an interrupted rotation might have.
+	if status := r.Run(append(args, "-g", "one")); status != 0 {
+		t.Fatalf("expected exit status 0 but found %d!", status)
+	}
+
+	expectGroupValues(t, b, newC, "one", values)
+	expectGroupValues(t, b, c, "two", values)
+
+	// Running again over everything finishes the job.
+	if status := r.Run(append(args, "-all")); status != 0 {
+		t.Fatalf("expected exit status 0 but found %d!", status)
+	}
+
+	expectGroupValues(t, b, newC, "one", values)
+	expectGroupValues(t, b, newC, "two", values)
+}
+
+func TestRotateCommandCrypterSetting(t *testing.T) {
+	keyPath, c := writeTestKey(t, "std")
+	newKeyPath, newC := writeTestKey(t, "gcm")
+
+	b, err := backend.NewBackend("memory", "context", "TestRotateCommandCrypterSetting")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encryptedValue, err := crypter.EncryptAndSignWithData(c, []byte("1"), crypter.AssociatedData("context", "one", "A"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.SetVariable("one", "A", encryptedValue); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without -new-crypter, the new key is used with the crypter setting.
+	os.Setenv("CONTEXT_CRYPTER", "gcm")
+	defer os.Unsetenv("CONTEXT_CRYPTER")
+
+	r := &RotateCommand{}
+	if status := r.Run([]string{"-backend", "memory", "-a", "TestRotateCommandCrypterSetting", "-k", keyPath, "-new-k", newKeyPath, "-g", "one"}); status != 0 {
+		t.Fatalf("expected exit status 0 but found %d!", status)
+	}
+
+	expectGroupValues(t, b, newC, "one", map[string]string{"A": "1"})
+}
+
+// expectGroupValues checks that every value in group decrypts using c.
+func expectGroupValues(t *testing.T, b backend.Backend, c crypter.Crypter, group string, expected map[string]string) {
+	encryptedEnv, err := b.GetGroup(group)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(encryptedEnv) != len(expected) {
+		t.Errorf("expected %d variables in %s but found %d!", len(expected), group, len(encryptedEnv))
+	}
+
+	for variable, encryptedValue := range encryptedEnv {
+		value, err := crypter.ValidateAndDecryptWithData(c, encryptedValue, crypter.AssociatedData("context", group, variable))
+		if err != nil {
+			t.Errorf("%s/%s: %s", group, variable, err)
+		} else if string(value) != expected[variable] {
+			t.Errorf("expected value %q for %s/%s but found %q!", expected[variable], group, variable, value)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package command
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/newsdev/context/backend"
+	"github.com/newsdev/context/crypter"
+	"github.com/newsdev/context/options"
+	"github.com/newsdev/context/server"
+)
+
+type ServerCommand struct{}
+
+func (s *ServerCommand) Run(args []string) int {
+	var keyPath, policyPath, listenAddress, certPath, certKeyPath, clientCAPath, crypterType, backendType, backendAddress, backendNamespace string
+	flagArgs := newOptionFlags("server")
+	flagArgs.Option(&backendAddress, "a", options.Address, "backend address")
+	flagArgs.Option(&backendNamespace, "n", options.Namespace, "backend namespace prefix")
+	flagArgs.DeprecatedProtocol()
+	flagArgs.Option(&backendType, "backend", options.Backend, "backend to use")
+	flagArgs.Option(&crypterType, "crypter", options.Crypter, "crypter to use for new values and values without an envelope")
+	flagArgs.Option(&keyPath, "k", options.KeyPath, "path to a key file")
+	flagArgs.StringVar(&policyPath, "policy", "/etc/context/server.json", "path to the policy of tokens and rules")
+	flagArgs.StringVar(&listenAddress, "listen", "127.0.0.1:4002", "address to listen on")
+	flagArgs.StringVar(&certPath, "tls-cert", "", "path to the server's TLS certificate")
+	flagArgs.StringVar(&certKeyPath, "tls-key", "", "path to the server's TLS key")
+	flagArgs.StringVar(&clientCAPath, "tls-client-ca", "", "path to the CA certificates that client certificates are verified with")
+	if err := flagArgs.Parse(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	tlsConfig, err := serverTLSConfig(certPath, certKeyPath, clientCAPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// Tokens and values would cross the network in the clear without TLS,
+	// so only allow that on the loopback interface.
+	if tlsConfig == nil && !isLoopback(listenAddress) {
+		fmt.Fprintln(os.Stderr, "-tls-cert and -tls-key are required to listen on", listenAddress)
+		return 1
+	}
+
+	policy, err := server.ReadPolicy(policyPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// Read the key, checking its permissions.
+	key, err := crypter.ReadKey(keyPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	c, err := crypter.NewEnvelopeCrypter(crypterType, key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	b, err := backend.NewBackend(backendType, backendNamespace, backendAddress)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	httpServer := &http.Server{
+		Addr:      listenAddress,
+		Handler:   server.NewHandler(b, c, policy),
+		TLSConfig: tlsConfig,
+	}
+
+	if tlsConfig != nil {
+		err = httpServer.ListenAndServeTLS(certPath, certKeyPath)
+	} else {
+		err = httpServer.ListenAndServe()
+	}
+
+	fmt.Fprintln(os.Stderr, err)
+	return 1
+}
+
+// serverTLSConfig returns the TLS configuration for the given certificate,
+// or nil if there is none. With a client CA, clients may identify themselves
+// with a certificate instead of a token.
+func serverTLSConfig(certPath, certKeyPath, clientCAPath string) (*tls.Config, error) {
+	if certPath == "" && certKeyPath == "" {
+		if clientCAPath != "" {
+			return nil, errors.New("-tls-client-ca requires -tls-cert and -tls-key")
+		}
+		return nil, nil
+	}
+
+	if certPath == "" || certKeyPath == "" {
+		return nil, errors.New("-tls-cert and -tls-key must be given together")
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if clientCAPath != "" {
+		pem, err := ioutil.ReadFile(clientCAPath)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", clientCAPath)
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return config, nil
+}
+
+func isLoopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (s *ServerCommand) Help() string { return "" }
+
+func (s *ServerCommand) Synopsis() string { return "" }
@@ -0,0 +1,38 @@
+package command
+
+import (
+	"testing"
+)
+
+func TestIsLoopback(t *testing.T) {
+	for address, expected := range map[string]bool{
+		"127.0.0.1:4002": true,
+		"[::1]:4002":     true,
+		"localhost:4002": true,
+		"0.0.0.0:4002":   false,
+		":4002":          false,
+		"10.0.0.1:4002":  false,
+		"127.0.0.1":      false,
+	} {
+		if loopback := isLoopback(address); loopback != expected {
+			t.Errorf("%s: expected %t but found %t!", address, expected, loopback)
+		}
+	}
+}
+
+func TestServerTLSConfig(t *testing.T) {
+	if config, err := serverTLSConfig("", "", ""); err != nil || config != nil {
+		t.Errorf("expected no TLS configuration but found %v, %v!", config, err)
+	}
+
+	for _, paths := range [][3]string{
+		{"cert.pem", "", ""},
+		{"", "key.pem", ""},
+		{"", "", "ca.pem"},
+		{"cert.pem", "key.pem", "/nonexistent/ca.pem"},
+	} {
+		if _, err := serverTLSConfig(paths[0], paths[1], paths[2]); err == nil {
+			t.Errorf("expected an error for %q!", paths)
+		}
+	}
+}
@@ -1,73 +1,136 @@
 package command
 
 import (
-	"flag"
+	"bytes"
+	"crypto/rand"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/big"
 	"os"
 
 	"code.google.com/p/gopass"
 	"github.com/newsdev/context/backend"
 	"github.com/newsdev/context/crypter"
+	"github.com/newsdev/context/options"
 )
 
+// DefaultAlphabet is the set of characters that generated values are drawn
+// from unless another is given.
+const DefaultAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// generateValue returns a random string of the given length drawn uniformly
+// from alphabet.
+func generateValue(length int, alphabet string) (string, error) {
+	if length <= 0 {
+		return "", errors.New("generated values must have a positive length")
+	}
+
+	characters := []rune(alphabet)
+	if len(characters) < 2 {
+		return "", errors.New("the alphabet must have at least two characters")
+	}
+
+	max := big.NewInt(int64(len(characters)))
+	value := make([]rune, length)
+	for i := range value {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		value[i] = characters[n.Int64()]
+	}
+
+	return string(value), nil
+}
+
 type SetCommand struct {
 	Group, Addr, PrivateKeyFilepath string
 	UseEnvironment                  bool
 }
 
 func (s *SetCommand) Run(args []string) int {
-	var keyPath, group, crypterType, backendType, backendProtocol, backendAddress, backendNamespace string
-	flagArgs := flag.NewFlagSet("set", flag.ContinueOnError)
-	flagArgs.StringVar(&backendAddress, "a", "http://127.0.0.1:4001", "backend address")
-	flagArgs.StringVar(&backendNamespace, "n", "context", "backend namespace prefix")
-	flagArgs.StringVar(&backendProtocol, "protocol", "tcp", "backend protocol")
-	flagArgs.StringVar(&backendType, "backend", "etcd", "backend to use")
-	flagArgs.StringVar(&crypterType, "crypter", "std", "crypter to use")
-	flagArgs.StringVar(&group, "g", "default", "group")
-	flagArgs.StringVar(&keyPath, "k", "/etc/context/key", "path to a key file")
+	var keyPath, group, crypterType, backendType, backendAddress, backendNamespace, valuePath, alphabet string
+	var useStdin bool
+	var generateLength int
+	flagArgs := newOptionFlags("set")
+	flagArgs.Option(&backendAddress, "a", options.Address, "backend address")
+	flagArgs.Option(&backendNamespace, "n", options.Namespace, "backend namespace prefix")
+	flagArgs.DeprecatedProtocol()
+	flagArgs.Option(&backendType, "backend", options.Backend, "backend to use")
+	flagArgs.Option(&crypterType, "crypter", options.Crypter, "crypter to use")
+	flagArgs.Option(&group, "g", options.Group, "group")
+	flagArgs.Option(&keyPath, "k", options.KeyPath, "path to a key file")
+	flagArgs.BoolVar(&useStdin, "stdin", false, "read the value from standard input")
+	flagArgs.StringVar(&valuePath, "f", "", "read the value from a file")
+	flagArgs.BoolVar(&s.UseEnvironment, "env", s.UseEnvironment, "take values from the current environment")
+	flagArgs.IntVar(&generateLength, "generate", 0, "generate random values of the given length")
+	flagArgs.StringVar(&alphabet, "alphabet", DefaultAlphabet, "characters to use for generated values")
 	if err := flagArgs.Parse(args); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return 1
 	}
 
-	// Check the status of the secret file.
-	stat, err := os.Stat(keyPath)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
+	modes := 0
+	for _, set := range []bool{useStdin, valuePath != "", s.UseEnvironment, generateLength != 0} {
+		if set {
+			modes++
+		}
+	}
+
+	if modes > 1 {
+		fmt.Fprintln(os.Stderr, "only one of -stdin, -f, -env and -generate may be given")
 		return 1
 	}
 
-	// Only proceed if the running user is the only user that can read the
-	// secret.
-	if mode := stat.Mode(); mode != 0600 && mode != 0400 {
-		fmt.Fprintln(os.Stderr, "incorrect file mode for key")
+	variables := flagArgs.Args()
+	if len(variables) == 0 {
+		fmt.Fprintln(os.Stderr, "no variables given")
 		return 1
 	}
 
-	// Attempt to read the entire content of the secret file.
-	file, err := os.Open(keyPath)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
+	if (useStdin || valuePath != "") && len(variables) != 1 {
+		fmt.Fprintln(os.Stderr, "-stdin and -f set exactly one variable")
 		return 1
 	}
 
-	key, err := ioutil.ReadAll(file)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		if err := file.Close(); err != nil {
+	// Read a single value up front, before touching the key or backend.
+	var input []byte
+	if useStdin {
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
+			return 1
 		}
-		return 1
+
+		// Drop the line ending that echo and most editors add, including
+		// the Windows one.
+		if bytes.HasSuffix(data, []byte("\r\n")) {
+			input = data[:len(data)-2]
+		} else {
+			input = bytes.TrimSuffix(data, []byte("\n"))
+		}
+	} else if valuePath != "" {
+
+		// Files are used as is, so certificates and keys keep their trailing
+		// newlines.
+		data, err := ioutil.ReadFile(valuePath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		input = data
 	}
 
-	if err := file.Close(); err != nil {
+	// Read the key, checking its permissions.
+	key, err := crypter.ReadKey(keyPath)
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return 1
 	}
 
 	// Use the key to create a new crypter of the given type.
-	crypter, err := crypter.NewCrypter(crypterType, key)
+	c, err := crypter.NewEnvelopeCrypter(crypterType, key)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return 1
@@ -79,12 +142,33 @@ func (s *SetCommand) Run(args []string) int {
 		return 1
 	}
 
-	for _, variable := range flagArgs.Args() {
+	encryptedEnv, err := b.GetGroup(group)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	for _, variable := range variables {
 
-		var value string
-		if envValue := os.Getenv(variable); s.UseEnvironment && envValue != "" {
-			value = envValue
-		} else {
+		var value []byte
+		switch {
+		case useStdin || valuePath != "":
+			value = input
+		case s.UseEnvironment:
+			envValue, ok := os.LookupEnv(variable)
+			if !ok {
+				fmt.Fprintf(os.Stderr, "%s is not set in the environment\n", variable)
+				return 1
+			}
+			value = []byte(envValue)
+		case generateLength != 0:
+			generatedValue, err := generateValue(generateLength, alphabet)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			value = []byte(generatedValue)
+		default:
 
 			// Get the value from user input.
 			inputValue, err := gopass.GetPass(fmt.Sprintf("%s=", variable))
@@ -92,11 +176,25 @@ func (s *SetCommand) Run(args []string) int {
 				fmt.Fprintln(os.Stderr, err)
 				return 1
 			}
+			value = []byte(inputValue)
+		}
 
-			value = inputValue
+		data := crypter.AssociatedData(b.Namespace(), group, variable)
+
+		// Report whether the variable changed, never the value itself. Values
+		// stored in an older format are rewritten even if they're unchanged.
+		status := "added"
+		if encryptedValue, ok := encryptedEnv[variable]; ok {
+			if current, err := crypter.ValidateAndDecryptWithData(c, encryptedValue, data); err == nil && bytes.Equal(current, value) && crypter.Current(c, encryptedValue) {
+				fmt.Printf("%s: unchanged\n", variable)
+				continue
+			}
+			status = "updated"
 		}
 
-		ecryptedValue, err := crypter.EncryptAndSign([]byte(value))
+		// Bind the value to its location so that it can't be moved to another
+		// variable or group by anyone with write access to the backend.
+		ecryptedValue, err := crypter.EncryptAndSignWithData(c, value, data)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			return 1
@@ -106,6 +204,8 @@ func (s *SetCommand) Run(args []string) int {
 			fmt.Fprintln(os.Stderr, err)
 			return 1
 		}
+
+		fmt.Printf("%s: %s\n", variable, status)
 	}
 
 	return 0
@@ -0,0 +1,254 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/newsdev/context/backend"
+	"github.com/newsdev/context/crypter"
+)
+
+// writeTestKey writes a new key of the given kind to a temporary directory
+// and returns its path along with a crypter that uses it.
+func writeTestKey(t *testing.T, kind string) (string, crypter.Crypter) {
+	dir, err := ioutil.TempDir("", "context-command")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	key, err := crypter.NewKey(kind)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyPath := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(keyPath, key, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := crypter.NewEnvelopeCrypter(kind, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keyPath, c
+}
+
+func TestSetCommandUseEnvironment(t *testing.T) {
+	for _, kind := range []string{"std", "gcm"} {
+		testSetCommandUseEnvironment(t, kind)
+	}
+}
+
+func testSetCommandUseEnvironment(t *testing.T, kind string) {
+	keyPath, c := writeTestKey(t, kind)
+
+	os.Setenv("CONTEXT_TEST_SET", "from the environment")
+	defer os.Unsetenv("CONTEXT_TEST_SET")
+
+	s := &SetCommand{UseEnvironment: true}
+	if status := s.Run([]string{"-backend", "memory", "-a", "TestSetCommandUseEnvironment", "-crypter", kind, "-k", keyPath, "-g", "testgroup", "CONTEXT_TEST_SET"}); status != 0 {
+		t.Fatalf("expected exit status 0 but found %d!", status)
+	}
+
+	b, err := backend.NewBackend("memory", "context", "TestSetCommandUseEnvironment")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encryptedValue, err := b.GetVariable("testgroup", "CONTEXT_TEST_SET")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := crypter.ValidateAndDecryptWithData(c, encryptedValue, crypter.AssociatedData("context", "testgroup", "CONTEXT_TEST_SET"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(value) != "from the environment" {
+		t.Errorf("expected value \"from the environment\" but found %q!", value)
+	}
+}
+
+func TestSetCommandInputModes(t *testing.T) {
+	keyPath, c := writeTestKey(t, "gcm")
+
+	b, err := backend.NewBackend("memory", "context", "TestSetCommandInputModes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{"-backend", "memory", "-a", "TestSetCommandInputModes", "-crypter", "gcm", "-k", keyPath, "-g", "testgroup"}
+	s := &SetCommand{}
+
+	// Values from files are used as is.
+	certPath := filepath.Join(filepath.Dir(keyPath), "cert.pem")
+	if err := ioutil.WriteFile(certPath, []byte("-----BEGIN CERTIFICATE-----\nabc\n-----END CERTIFICATE-----\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var status int
+	output := captureStdout(t, func() { status = s.Run(append(args, "-f", certPath, "CERT")) })
+	if status != 0 {
+		t.Fatalf("expected exit status 0 but found %d!", status)
+	}
+	if expected := "CERT: added\n"; output != expected {
+		t.Errorf("expected %q but found %q!", expected, output)
+	}
+
+	// A single trailing newline is dropped from standard input.
+	stdinPath := filepath.Join(filepath.Dir(keyPath), "stdin")
+	if err := ioutil.WriteFile(stdinPath, []byte("from stdin\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	stdin, err := os.Open(stdinPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+
+	oldStdin := os.Stdin
+	os.Stdin = stdin
+	defer func() { os.Stdin = oldStdin }()
+
+	output = captureStdout(t, func() { status = s.Run(append(args, "-stdin", "CERT")) })
+	if status != 0 {
+		t.Fatalf("expected exit status 0 but found %d!", status)
+	}
+	if expected := "CERT: updated\n"; output != expected {
+		t.Errorf("expected %q but found %q!", expected, output)
+	}
+
+	expectGroupValues(t, b, c, "testgroup", map[string]string{"CERT": "from stdin"})
+
+	// So is a single Windows line ending.
+	if err := ioutil.WriteFile(stdinPath, []byte("from windows\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if os.Stdin, err = os.Open(stdinPath); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Stdin.Close()
+
+	captureStdout(t, func() { status = s.Run(append(args, "-stdin", "CERT")) })
+	if status != 0 {
+		t.Fatalf("expected exit status 0 but found %d!", status)
+	}
+
+	expectGroupValues(t, b, c, "testgroup", map[string]string{"CERT": "from windows"})
+
+	output = captureStdout(t, func() { status = s.Run(append(args, "-generate", "32", "-alphabet", "ab", "A", "B")) })
+	if status != 0 {
+		t.Fatalf("expected exit status 0 but found %d!", status)
+	}
+	if expected := "A: added\nB: added\n"; output != expected {
+		t.Errorf("expected %q but found %q!", expected, output)
+	}
+
+	for _, variable := range []string{"A", "B"} {
+		encryptedValue, err := b.GetVariable("testgroup", variable)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		value, err := crypter.ValidateAndDecryptWithData(c, encryptedValue, crypter.AssociatedData("context", "testgroup", variable))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(value) != 32 || strings.Trim(string(value), "ab") != "" {
+			t.Errorf("expected 32 characters from \"ab\" but found %q!", value)
+		}
+	}
+
+	if status := s.Run(append(args, "-stdin", "-generate", "8", "A")); status == 0 {
+		t.Error("expected conflicting input modes to fail!")
+	}
+
+	if status := s.Run(append(args, "-env", "CONTEXT_TEST_UNSET")); status == 0 {
+		t.Error("expected a variable missing from the environment to fail!")
+	}
+}
+
+func TestSetCommandUpgradesUnchanged(t *testing.T) {
+	keyPath, c := writeTestKey(t, "gcm")
+
+	b, err := backend.NewBackend("memory", "context", "TestSetCommandUpgradesUnchanged")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bare, err := crypter.NewCrypter("gcm", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A value stored without an envelope is rewritten even though it is
+	// unchanged, and left alone once it's current.
+	encryptedValue, err := crypter.EncryptAndSignWithData(bare, []byte("value"), crypter.AssociatedData("context", "testgroup", "A"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetVariable("testgroup", "A", encryptedValue); err != nil {
+		t.Fatal(err)
+	}
+
+	valuePath := filepath.Join(filepath.Dir(keyPath), "value")
+	if err := ioutil.WriteFile(valuePath, []byte("value"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{"-backend", "memory", "-a", "TestSetCommandUpgradesUnchanged", "-crypter", "gcm", "-k", keyPath, "-g", "testgroup", "-f", valuePath, "A"}
+	s := &SetCommand{}
+	for _, expected := range []string{"A: updated\n", "A: unchanged\n"} {
+		var status int
+		output := captureStdout(t, func() { status = s.Run(args) })
+		if status != 0 {
+			t.Fatalf("expected exit status 0 but found %d!", status)
+		}
+		if output != expected {
+			t.Errorf("expected %q but found %q!", expected, output)
+		}
+	}
+
+	encryptedValue, err = b.GetVariable("testgroup", "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !crypter.Current(c, encryptedValue) {
+		t.Error("expected the value to be rewritten in an envelope!")
+	}
+
+	expectGroupValues(t, b, c, "testgroup", map[string]string{"A": "value"})
+}
+
+func TestGenerateValue(t *testing.T) {
+	if _, err := generateValue(0, DefaultAlphabet); err == nil {
+		t.Error("expected an error for a zero length!")
+	}
+
+	if _, err := generateValue(8, "a"); err == nil {
+		t.Error("expected an error for a single character alphabet!")
+	}
+
+	value, err := generateValue(16, "αβγ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len([]rune(value)); n != 16 {
+		t.Errorf("expected 16 characters but found %d!", n)
+	}
+}
@@ -0,0 +1,38 @@
+package command
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// newCommand returns a command to be run as a child of this process, using
+// the standard streams of this one.
+func newCommand(path string, args, env []string, cred *credential) *exec.Cmd {
+	cmd := exec.Command(path)
+	cmd.Args = args
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// The child runs as the target user while this process keeps its own
+	// privileges, which it may need to read the key again or remove the files
+	// it wrote.
+	if cred != nil {
+		groups := make([]uint32, len(cred.Groups))
+		for i, group := range cred.Groups {
+			groups[i] = uint32(group)
+		}
+
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			Credential: &syscall.Credential{
+				Uid:    uint32(cred.Uid),
+				Gid:    uint32(cred.Gid),
+				Groups: groups,
+			},
+		}
+	}
+
+	return cmd
+}
@@ -1,24 +1,24 @@
 package command
 
 import (
-	"flag"
 	"fmt"
 	"os"
 
 	"github.com/newsdev/context/backend"
+	"github.com/newsdev/context/options"
 )
 
 type UnsetCommand struct{}
 
 func (s *UnsetCommand) Run(args []string) int {
 
-	var group, backendType, backendProtocol, backendAddress, backendNamespace string
-	flagArgs := flag.NewFlagSet("unset", flag.ContinueOnError)
-	flagArgs.StringVar(&backendAddress, "a", "http://127.0.0.1:4001", "backend address")
-	flagArgs.StringVar(&backendNamespace, "n", "context", "backend namespace prefix")
-	flagArgs.StringVar(&backendProtocol, "protocol", "tcp", "backend protocol")
-	flagArgs.StringVar(&backendType, "backend", "etcd", "backend to use")
-	flagArgs.StringVar(&group, "g", "default", "group")
+	var group, backendType, backendAddress, backendNamespace string
+	flagArgs := newOptionFlags("unset")
+	flagArgs.Option(&backendAddress, "a", options.Address, "backend address")
+	flagArgs.Option(&backendNamespace, "n", options.Namespace, "backend namespace prefix")
+	flagArgs.DeprecatedProtocol()
+	flagArgs.Option(&backendType, "backend", options.Backend, "backend to use")
+	flagArgs.Option(&group, "g", options.Group, "group")
 	if err := flagArgs.Parse(args); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return 1
@@ -31,7 +31,7 @@ func (s *UnsetCommand) Run(args []string) int {
 	}
 
 	for _, variable := range flagArgs.Args() {
-		if b.RemoveVariable(group, variable); err != nil {
+		if err := b.RemoveVariable(group, variable); err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			return 1
 		}
@@ -0,0 +1,53 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/newsdev/context/backend"
+)
+
+func TestUnsetCommand(t *testing.T) {
+	b, err := backend.NewBackend("memory", "context", "TestUnsetCommand")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, variable := range []string{"A", "B", "C"} {
+		if err := b.SetVariable("testgroup", variable, []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := &UnsetCommand{}
+	if status := c.Run([]string{"-backend", "memory", "-a", "TestUnsetCommand", "-g", "testgroup", "A", "C"}); status != 0 {
+		t.Fatalf("expected exit status 0 but found %d!", status)
+	}
+
+	variables, err := b.GetGroup("testgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(variables) != 1 {
+		t.Errorf("expected 1 variable but found %d!", len(variables))
+	}
+	if _, ok := variables["B"]; !ok {
+		t.Error("variable B was removed!")
+	}
+}
+
+func TestUnsetCommandError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "context-command")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The file backend refuses names that aren't valid file names.
+	c := &UnsetCommand{}
+	if status := c.Run([]string{"-backend", "file", "-a", dir, "-g", "testgroup", "../A"}); status != 1 {
+		t.Errorf("expected exit status 1 but found %d!", status)
+	}
+}
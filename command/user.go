@@ -0,0 +1,128 @@
+package command
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// A credential is a user to run a command as, along with the groups and
+// environment that go with it.
+type credential struct {
+	Uid, Gid int
+	Groups   []int
+	Username string
+	HomeDir  string
+}
+
+// lookupCredential resolves a user[:group] specification, where each part
+// may be a name or a numeric id. Without a group, the user's primary group
+// is used. Supplementary groups are always the user's own.
+func lookupCredential(spec string) (*credential, error) {
+	userSpec, groupSpec := spec, ""
+	if i := strings.IndexByte(spec, ':'); i >= 0 {
+		userSpec, groupSpec = spec[:i], spec[i+1:]
+	}
+
+	if userSpec == "" {
+		return nil, UserError{spec, "no user given"}
+	}
+
+	u, err := lookupUser(userSpec)
+	if err != nil {
+		return nil, UserError{spec, err.Error()}
+	}
+
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return nil, UserError{spec, err.Error()}
+	}
+
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return nil, UserError{spec, err.Error()}
+	}
+
+	if groupSpec != "" {
+		g, err := lookupGroup(groupSpec)
+		if err != nil {
+			return nil, UserError{spec, err.Error()}
+		}
+
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return nil, UserError{spec, err.Error()}
+		}
+	}
+
+	groupIds, err := u.GroupIds()
+	if err != nil {
+		return nil, UserError{spec, err.Error()}
+	}
+
+	groups := []int{gid}
+	for _, groupId := range groupIds {
+		id, err := strconv.Atoi(groupId)
+		if err != nil {
+			return nil, UserError{spec, err.Error()}
+		}
+
+		if id != gid {
+			groups = append(groups, id)
+		}
+	}
+
+	return &credential{
+		Uid:      uid,
+		Gid:      gid,
+		Groups:   groups,
+		Username: u.Username,
+		HomeDir:  u.HomeDir,
+	}, nil
+}
+
+func lookupUser(spec string) (*user.User, error) {
+	if _, err := strconv.Atoi(spec); err == nil {
+		return user.LookupId(spec)
+	}
+	return user.Lookup(spec)
+}
+
+func lookupGroup(spec string) (*user.Group, error) {
+	if _, err := strconv.Atoi(spec); err == nil {
+		return user.LookupGroupId(spec)
+	}
+	return user.LookupGroup(spec)
+}
+
+// setEnvironment sets the variables that programs use to find out who they
+// are running as.
+func (c *credential) setEnvironment(env map[string]string) {
+	env["HOME"] = c.HomeDir
+	env["USER"] = c.Username
+	env["LOGNAME"] = c.Username
+}
+
+// drop switches the process to the credential. Groups are changed first,
+// since that is no longer allowed once the user has changed.
+func (c *credential) drop() error {
+	if err := syscall.Setgroups(c.Groups); err != nil {
+		return err
+	}
+
+	if err := syscall.Setgid(c.Gid); err != nil {
+		return err
+	}
+
+	return syscall.Setuid(c.Uid)
+}
+
+type UserError struct {
+	Spec string
+	Err  string
+}
+
+func (e UserError) Error() string {
+	return fmt.Sprintf("command: user \"%s\": %s", e.Spec, e.Err)
+}
@@ -0,0 +1,54 @@
+package command
+
+import (
+	"os/user"
+	"strconv"
+	"testing"
+)
+
+func TestLookupCredential(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	group, err := user.LookupGroupId(current.Gid)
+	if err != nil {
+		t.Skip(err)
+	}
+
+	for _, spec := range []string{
+		current.Username,
+		current.Uid,
+		current.Username + ":" + group.Name,
+		current.Uid + ":" + current.Gid,
+	} {
+		cred, err := lookupCredential(spec)
+		if err != nil {
+			t.Errorf("%s: %s", spec, err)
+			continue
+		}
+
+		if strconv.Itoa(cred.Uid) != current.Uid || strconv.Itoa(cred.Gid) != current.Gid {
+			t.Errorf("%s: expected %s:%s but found %d:%d!", spec, current.Uid, current.Gid, cred.Uid, cred.Gid)
+		}
+
+		if len(cred.Groups) == 0 || cred.Groups[0] != cred.Gid {
+			t.Errorf("%s: expected the primary group first but found %v!", spec, cred.Groups)
+		}
+
+		env := make(map[string]string)
+		cred.setEnvironment(env)
+		if env["USER"] != current.Username || env["HOME"] != current.HomeDir {
+			t.Errorf("%s: unexpected environment %v!", spec, env)
+		}
+	}
+
+	for _, spec := range []string{"", ":" + current.Gid, "context-no-such-user", current.Username + ":context-no-such-group"} {
+		if _, err := lookupCredential(spec); err == nil {
+			t.Errorf("expected an error for %q!", spec)
+		} else if _, ok := err.(UserError); !ok {
+			t.Errorf("expected a UserError but found %v!", err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// WatchRetryDelay is how long to wait before watching a group again after
+// its watch failed.
+var WatchRetryDelay = 5 * time.Second
+
+// A groupWatcher reports changes to groups, as both backends and the agent
+// do.
+type groupWatcher interface {
+	WatchGroup(group string, changes chan<- string, started chan<- struct{}, stop <-chan bool) error
+}
+
+// watchGroups watches each of the groups, sending on the returned channel
+// once changes have stopped arriving for the debounce period, so that a
+// burst of changes, such as a rotation, is acted on once. Failed watches are
+// reported and retried. Watching ends when stop is closed.
+func watchGroups(w groupWatcher, groups []string, debounce time.Duration, stop <-chan bool) <-chan []string {
+	changes := make(chan string)
+	for _, group := range groups {
+		go func(group string) {
+			for {
+				err := w.WatchGroup(group, changes, nil, stop)
+				if err == nil {
+					return
+				}
+
+				fmt.Fprintf(os.Stderr, "%s: %s\n", group, err)
+				select {
+				case <-stop:
+					return
+				case <-time.After(WatchRetryDelay):
+				}
+			}
+		}(group)
+	}
+
+	batches := make(chan []string)
+	go func() {
+		changed := make(map[string]bool)
+		var timer <-chan time.Time
+		for {
+			select {
+			case <-stop:
+				return
+			case group := <-changes:
+				changed[group] = true
+				timer = time.After(debounce)
+			case <-timer:
+				batch := make([]string, 0, len(changed))
+				for _, group := range groups {
+					if changed[group] {
+						batch = append(batch, group)
+					}
+				}
+
+				select {
+				case batches <- batch:
+				case <-stop:
+					return
+				}
+
+				changed = make(map[string]bool)
+				timer = nil
+			}
+		}
+	}()
+
+	return batches
+}
+
+var signalNames = map[string]syscall.Signal{
+	"HUP":   syscall.SIGHUP,
+	"INT":   syscall.SIGINT,
+	"QUIT":  syscall.SIGQUIT,
+	"KILL":  syscall.SIGKILL,
+	"USR1":  syscall.SIGUSR1,
+	"USR2":  syscall.SIGUSR2,
+	"TERM":  syscall.SIGTERM,
+	"WINCH": syscall.SIGWINCH,
+}
+
+// parseSignal reads a signal given by name, with or without the SIG prefix,
+// or by number.
+func parseSignal(name string) (syscall.Signal, error) {
+	if n, err := strconv.Atoi(name); err == nil && n > 0 {
+		return syscall.Signal(n), nil
+	}
+
+	if sig, ok := signalNames[strings.TrimPrefix(strings.ToUpper(name), "SIG")]; ok {
+		return sig, nil
+	}
+
+	return 0, fmt.Errorf("unknown signal \"%s\"", name)
+}
@@ -0,0 +1,67 @@
+package command
+
+import (
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/newsdev/context/backend"
+)
+
+func TestWatchGroups(t *testing.T) {
+	b, err := backend.NewBackend("memory", "context", "TestWatchGroups")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan bool)
+	defer close(stop)
+	batches := watchGroups(b, []string{"shared", "app"}, 100*time.Millisecond, stop)
+
+	// The memory backend's watches start at once, but give them a moment.
+	time.Sleep(50 * time.Millisecond)
+
+	// A burst of changes across both groups is reported as one batch.
+	for i := 0; i < 5; i++ {
+		for _, group := range []string{"app", "shared"} {
+			if err := b.SetVariable(group, "A", []byte{byte(i)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	select {
+	case batch := <-batches:
+		if expected := []string{"shared", "app"}; !reflect.DeepEqual(batch, expected) {
+			t.Errorf("expected %q but found %q!", expected, batch)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a batch of changes!")
+	}
+
+	select {
+	case batch := <-batches:
+		t.Errorf("expected a single batch but found another, %q!", batch)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestParseSignal(t *testing.T) {
+	for name, expected := range map[string]syscall.Signal{
+		"HUP":     syscall.SIGHUP,
+		"sigusr1": syscall.SIGUSR1,
+		"SIGTERM": syscall.SIGTERM,
+		"10":      syscall.Signal(10),
+	} {
+		if sig, err := parseSignal(name); err != nil {
+			t.Errorf("%s: %s", name, err)
+		} else if sig != expected {
+			t.Errorf("%s: expected %s but found %s!", name, expected, sig)
+		}
+	}
+
+	if _, err := parseSignal("NOPE"); err == nil {
+		t.Error("expected an error for an unknown signal!")
+	}
+}
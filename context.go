@@ -25,9 +25,33 @@ func main() {
 		"key": func() (cli.Command, error) {
 			return &command.KeyCommand{}, nil
 		},
+		"get": func() (cli.Command, error) {
+			return &command.GetCommand{}, nil
+		},
+		"list": func() (cli.Command, error) {
+			return &command.ListCommand{}, nil
+		},
+		"export": func() (cli.Command, error) {
+			return &command.ExportCommand{}, nil
+		},
+		"import": func() (cli.Command, error) {
+			return &command.ImportCommand{}, nil
+		},
 		"exec": func() (cli.Command, error) {
 			return &command.ExecCommand{}, nil
 		},
+		"agent": func() (cli.Command, error) {
+			return &command.AgentCommand{}, nil
+		},
+		"server": func() (cli.Command, error) {
+			return &command.ServerCommand{}, nil
+		},
+		"migrate": func() (cli.Command, error) {
+			return &command.MigrateCommand{}, nil
+		},
+		"rotate": func() (cli.Command, error) {
+			return &command.RotateCommand{}, nil
+		},
 	}
 
 	exitStatus, err := c.Run()
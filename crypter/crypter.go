@@ -2,10 +2,14 @@ package crypter
 
 import (
 	"crypto/rand"
+	"encoding/binary"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
 
-	"github.com/buth/context/crypter/std"
+	"github.com/newsdev/context/crypter/gcm"
+	"github.com/newsdev/context/crypter/std"
 )
 
 type Crypter interface {
@@ -13,12 +17,77 @@ type Crypter interface {
 	ValidateAndDecrypt([]byte) ([]byte, error)
 }
 
+// An AssociatedDataCrypter is a Crypter that can also authenticate data that
+// is not encrypted along with the message, such as where the message is
+// stored. Validation fails if the data given differs from the data used
+// during encryption.
+type AssociatedDataCrypter interface {
+	Crypter
+	EncryptAndSignWithData(plainbytes, data []byte) ([]byte, error)
+	ValidateAndDecryptWithData(messagebytes, data []byte) ([]byte, error)
+}
+
+// AssociatedData returns data binding a value to the namespace, group and
+// variable it is stored under. Each component is length-prefixed so that
+// different combinations can't produce the same data.
+func AssociatedData(namespace, group, variable string) []byte {
+	data := make([]byte, 0, 3*binary.MaxVarintLen64+len(namespace)+len(group)+len(variable))
+	for _, component := range []string{namespace, group, variable} {
+		length := make([]byte, binary.MaxVarintLen64)
+		data = append(data, length[:binary.PutUvarint(length, uint64(len(component)))]...)
+		data = append(data, component...)
+	}
+	return data
+}
+
+// EncryptAndSignWithData encrypts plainbytes using c, binding data to the
+// result if c supports associated data.
+func EncryptAndSignWithData(c Crypter, plainbytes, data []byte) ([]byte, error) {
+	if adc, ok := c.(AssociatedDataCrypter); ok {
+		return adc.EncryptAndSignWithData(plainbytes, data)
+	}
+	return c.EncryptAndSign(plainbytes)
+}
+
+// ValidateAndDecryptWithData decrypts messagebytes using c, checking data if
+// c supports associated data.
+func ValidateAndDecryptWithData(c Crypter, messagebytes, data []byte) ([]byte, error) {
+	if adc, ok := c.(AssociatedDataCrypter); ok {
+		return adc.ValidateAndDecryptWithData(messagebytes, data)
+	}
+	return c.ValidateAndDecrypt(messagebytes)
+}
+
+// An OutdatedCrypter can tell when a message was produced in an older format
+// that should be rewritten.
+type OutdatedCrypter interface {
+	Crypter
+	Outdated(messagebytes []byte) bool
+}
+
+// Outdated reports whether messagebytes should be rewritten using c. It is
+// always false if c has only one format.
+func Outdated(c Crypter, messagebytes []byte) bool {
+	if oc, ok := c.(OutdatedCrypter); ok {
+		return oc.Outdated(messagebytes)
+	}
+	return false
+}
+
 func NewCrypter(kind string, key []byte) (Crypter, error) {
 
 	// Select a crypter based on kind.
 	switch kind {
 	case "std":
+		if len(key) != std.SymetricKeyLength+std.HmacKeyLength {
+			return nil, KeyLengthError{kind, std.SymetricKeyLength + std.HmacKeyLength, len(key)}
+		}
 		return std.New(key[:std.SymetricKeyLength], key[std.SymetricKeyLength:])
+	case "gcm":
+		if len(key) != gcm.KeyLength {
+			return nil, KeyLengthError{kind, gcm.KeyLength, len(key)}
+		}
+		return gcm.New(key)
 	}
 
 	// Assuming no crypter is implemented for kind.
@@ -27,18 +96,45 @@ func NewCrypter(kind string, key []byte) (Crypter, error) {
 
 func NewKey(kind string) ([]byte, error) {
 
-	// Select a crypter based on kind.
+	// Select a key length based on kind.
+	var length int
 	switch kind {
 	case "std":
-		key := make([]byte, std.SymetricKeyLength+std.HmacKeyLength)
-		if _, err := io.ReadFull(rand.Reader, key); err != nil {
-			return nil, err
-		}
-		return key, nil
+		length = std.SymetricKeyLength + std.HmacKeyLength
+	case "gcm":
+		length = gcm.KeyLength
+	default:
+
+		// Assuming no crypter is implemented for kind.
+		return nil, NoCrypterError{kind}
 	}
 
-	// Assuming no crypter is implemented for kind.
-	return nil, NoCrypterError{kind}
+	key := make([]byte, length)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ReadKey reads the key file at keyPath, refusing to do so unless the file
+// is readable only by its owner.
+func ReadKey(keyPath string) ([]byte, error) {
+
+	// Check the status of the secret file.
+	stat, err := os.Stat(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only proceed if the running user is the only user that can read the
+	// secret.
+	if mode := stat.Mode(); mode != 0600 && mode != 0400 {
+		return nil, KeyModeError{keyPath, mode}
+	}
+
+	// The key should have been saved as a binary, so no extra processing
+	// should be needed.
+	return ioutil.ReadFile(keyPath)
 }
 
 type NoCrypterError struct {
@@ -48,3 +144,21 @@ type NoCrypterError struct {
 func (e NoCrypterError) Error() string {
 	return fmt.Sprintf("crypter: crypter \"%s\" has not been implemented", e.Kind)
 }
+
+type KeyLengthError struct {
+	Kind             string
+	Expected, Actual int
+}
+
+func (e KeyLengthError) Error() string {
+	return fmt.Sprintf("crypter: crypter \"%s\" expects a %d byte key but was given %d bytes", e.Kind, e.Expected, e.Actual)
+}
+
+type KeyModeError struct {
+	Path string
+	Mode os.FileMode
+}
+
+func (e KeyModeError) Error() string {
+	return fmt.Sprintf("crypter: key file \"%s\" has mode %s, but must be readable only by its owner", e.Path, e.Mode)
+}
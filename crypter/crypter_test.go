@@ -2,11 +2,14 @@ package crypter
 
 import (
 	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
 var (
-	testKinds    = []string{"std"}
+	testKinds    = []string{"std", "gcm"}
 	message      = []byte("Test message !@#$%^&*()_1234567890{}[]✓.")
 	emptyMessage = []byte{}
 )
@@ -75,7 +78,7 @@ func TestCrypterEncodeDecode(t *testing.T) {
 		}
 
 		if !bytes.Equal(plainbytes, message) {
-			t.Errorf("decoded bytes did not match!", message, plainbytes)
+			t.Errorf("decoded bytes did not match! expected %q but found %q", message, plainbytes)
 		}
 	}
 }
@@ -108,7 +111,7 @@ func TestCrypterEncodeDecodeEmpty(t *testing.T) {
 		}
 
 		if !bytes.Equal(plainbytes, emptyMessage) {
-			t.Errorf("decoded bytes did not match!", message, plainbytes)
+			t.Errorf("decoded bytes did not match! expected %q but found %q", emptyMessage, plainbytes)
 		}
 	}
 }
@@ -141,7 +144,92 @@ func TestCrypterMultipleEncodings(t *testing.T) {
 		}
 
 		if bytes.Equal(cipherbytes1, cipherbytes2) {
-			t.Errorf("sequential encodings returned the same result!", cipherbytes1, cipherbytes2)
+			t.Errorf("sequential encodings returned the same result! %x", cipherbytes1)
 		}
 	}
 }
+
+func TestCrypterAssociatedData(t *testing.T) {
+	k, err := NewKey("gcm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewCrypter("gcm", k)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cipherbytes, err := EncryptAndSignWithData(c, message, AssociatedData("context", "group", "A"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plainbytes, err := ValidateAndDecryptWithData(c, cipherbytes, AssociatedData("context", "group", "A"))
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(plainbytes, message) {
+		t.Errorf("decoded bytes did not match! expected %q but found %q", message, plainbytes)
+	}
+
+	// A value copied to another variable or group must not validate.
+	for _, data := range [][]byte{
+		AssociatedData("context", "group", "B"),
+		AssociatedData("context", "other", "A"),
+		AssociatedData("other", "group", "A"),
+	} {
+		if _, err := ValidateAndDecryptWithData(c, cipherbytes, data); err == nil {
+			t.Errorf("value validated with the wrong associated data %q!", data)
+		}
+	}
+}
+
+func TestAssociatedDataUnambiguous(t *testing.T) {
+	if bytes.Equal(AssociatedData("a", "bc", "d"), AssociatedData("ab", "c", "d")) {
+		t.Error("different components produced the same associated data!")
+	}
+}
+
+func TestCrypterWrongKeyLength(t *testing.T) {
+	for _, kind := range testKinds {
+		if _, err := NewCrypter(kind, []byte("short")); err == nil {
+			t.Errorf("expected an error for a short %s key!", kind)
+		}
+	}
+}
+
+func TestReadKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "context-crypter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := NewKey("gcm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyPath := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(keyPath, key, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	readKey, err := ReadKey(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(readKey, key) {
+		t.Error("expected the key that was written!")
+	}
+
+	// A key that others can read is refused.
+	if err := os.Chmod(keyPath, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadKey(keyPath); err == nil {
+		t.Error("expected a key readable by others to be refused!")
+	} else if _, ok := err.(KeyModeError); !ok {
+		t.Errorf("expected a KeyModeError but found %T!", err)
+	}
+}
@@ -0,0 +1,264 @@
+package crypter
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+)
+
+const (
+
+	// EnvelopeVersion is the version of the envelope format written by
+	// envelope crypters.
+	EnvelopeVersion byte = 1
+
+	// KeyIDLength is the length in bytes of a key fingerprint.
+	KeyIDLength = 8
+)
+
+// EnvelopeMagic begins every enveloped message. Messages without it are
+// assumed to predate envelopes.
+var EnvelopeMagic = []byte("ctx\x00")
+
+// An Envelope records which crypter and which key produced a message. The
+// encoded form is the magic bytes, the envelope version, the length of the
+// kind followed by the kind, the key ID, and finally the payload.
+type Envelope struct {
+	Version byte
+	Kind    string
+	KeyID   []byte
+	Payload []byte
+}
+
+// KeyID returns a short fingerprint of key. It identifies a key without
+// revealing anything useful about it.
+func KeyID(key []byte) []byte {
+	sum := sha256.Sum256(key)
+	return sum[:KeyIDLength]
+}
+
+// header returns the encoded envelope without its payload.
+func (e Envelope) header() []byte {
+	header := make([]byte, 0, len(EnvelopeMagic)+2+len(e.Kind)+len(e.KeyID))
+	header = append(header, EnvelopeMagic...)
+	header = append(header, e.Version, byte(len(e.Kind)))
+	header = append(header, e.Kind...)
+	return append(header, e.KeyID...)
+}
+
+func (e Envelope) Bytes() []byte {
+	return append(e.header(), e.Payload...)
+}
+
+// ParseEnvelope decodes an enveloped message. The boolean result is false if
+// messagebytes does not begin with EnvelopeMagic.
+func ParseEnvelope(messagebytes []byte) (Envelope, bool, error) {
+	if !bytes.HasPrefix(messagebytes, EnvelopeMagic) {
+		return Envelope{}, false, nil
+	}
+
+	rest := messagebytes[len(EnvelopeMagic):]
+	if len(rest) < 2 {
+		return Envelope{}, true, EnvelopeError{"envelope is too short"}
+	}
+
+	e := Envelope{Version: rest[0]}
+	if e.Version != EnvelopeVersion {
+		return Envelope{}, true, EnvelopeError{fmt.Sprintf("unknown envelope version %d", e.Version)}
+	}
+
+	kindLength := int(rest[1])
+	rest = rest[2:]
+	if len(rest) < kindLength+KeyIDLength {
+		return Envelope{}, true, EnvelopeError{"envelope is too short"}
+	}
+
+	e.Kind = string(rest[:kindLength])
+	e.KeyID = rest[kindLength : kindLength+KeyIDLength]
+	e.Payload = rest[kindLength+KeyIDLength:]
+	return e, true, nil
+}
+
+// An envelopeCrypter wraps the messages of the crypter of its kind in an
+// Envelope. When decrypting it uses the crypter named in the envelope, and
+// checks that the envelope was produced with the same key.
+type envelopeCrypter struct {
+	mu       sync.Mutex
+	kind     string
+	key      []byte
+	keyID    []byte
+	crypters map[string]Crypter
+}
+
+// NewEnvelopeCrypter returns a crypter that writes enveloped messages using a
+// crypter of the given kind, and that reads enveloped messages of any kind as
+// well as bare messages of the given kind. It returns a KeyLengthError if the
+// crypter of the given kind can't use key.
+func NewEnvelopeCrypter(kind string, key []byte) (Crypter, error) {
+	e := newEnvelopeCrypter(kind, key)
+	if _, err := e.crypter(kind); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// NewEnvelopeReader is like NewEnvelopeCrypter, but also accepts a key that
+// only crypters of other kinds can use, for callers that only read: an
+// enveloped message names the crypter that opens it. Writing with such a key
+// is still an error.
+func NewEnvelopeReader(kind string, key []byte) (Crypter, error) {
+	e := newEnvelopeCrypter(kind, key)
+	if _, err := e.crypter(kind); err != nil {
+		if _, ok := err.(KeyLengthError); !ok {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+func newEnvelopeCrypter(kind string, key []byte) *envelopeCrypter {
+	k := make([]byte, len(key))
+	copy(k, key)
+
+	return &envelopeCrypter{
+		kind:     kind,
+		key:      k,
+		keyID:    KeyID(k),
+		crypters: make(map[string]Crypter),
+	}
+}
+
+func (e *envelopeCrypter) crypter(kind string) (Crypter, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if c, ok := e.crypters[kind]; ok {
+		return c, nil
+	}
+
+	c, err := NewCrypter(kind, e.key)
+	if err != nil {
+		return nil, err
+	}
+
+	e.crypters[kind] = c
+	return c, nil
+}
+
+func (e *envelopeCrypter) EncryptAndSign(plainbytes []byte) ([]byte, error) {
+	return e.EncryptAndSignWithData(plainbytes, nil)
+}
+
+func (e *envelopeCrypter) ValidateAndDecrypt(messagebytes []byte) ([]byte, error) {
+	return e.ValidateAndDecryptWithData(messagebytes, nil)
+}
+
+// EncryptAndSignWithData encrypts plainbytes and wraps the result in an
+// envelope. Crypters that support associated data also authenticate the
+// envelope header.
+func (e *envelopeCrypter) EncryptAndSignWithData(plainbytes, data []byte) ([]byte, error) {
+	c, err := e.crypter(e.kind)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope := Envelope{Version: EnvelopeVersion, Kind: e.kind, KeyID: e.keyID}
+	header := envelope.header()
+
+	envelope.Payload, err = EncryptAndSignWithData(c, plainbytes, append(header, data...))
+	if err != nil {
+		return nil, err
+	}
+
+	return envelope.Bytes(), nil
+}
+
+// ValidateAndDecryptWithData opens an enveloped message with the crypter it
+// names, or a bare message with the crypter of the configured kind.
+func (e *envelopeCrypter) ValidateAndDecryptWithData(messagebytes, data []byte) ([]byte, error) {
+	envelope, ok, err := ParseEnvelope(messagebytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		c, err := e.crypter(e.kind)
+		if err != nil {
+			return nil, err
+		}
+		return ValidateAndDecryptWithData(c, messagebytes, data)
+	}
+
+	if !bytes.Equal(envelope.KeyID, e.keyID) {
+		return nil, KeyMismatchError{envelope.KeyID, e.keyID}
+	}
+
+	c, err := e.crypter(envelope.Kind)
+	if err != nil {
+		return nil, err
+	}
+
+	return ValidateAndDecryptWithData(c, envelope.Payload, append(envelope.header(), data...))
+}
+
+// Outdated reports whether messagebytes predates envelopes or uses an older
+// format of its crypter. Messages produced with another key are not outdated,
+// since they can't be rewritten with this one.
+func (e *envelopeCrypter) Outdated(messagebytes []byte) bool {
+	envelope, ok, err := ParseEnvelope(messagebytes)
+	if err != nil {
+		return false
+	}
+
+	if !ok {
+		return true
+	}
+
+	if !bytes.Equal(envelope.KeyID, e.keyID) {
+		return false
+	}
+
+	c, err := e.crypter(envelope.Kind)
+	if err != nil {
+		return false
+	}
+
+	return Outdated(c, envelope.Payload)
+}
+
+// Current reports whether messagebytes is already in the form c would write
+// it in: for an enveloping crypter, an envelope of its kind and key in the
+// latest format, and otherwise any message that isn't outdated. A value that
+// isn't current should be rewritten even if it hasn't changed.
+func Current(c Crypter, messagebytes []byte) bool {
+	e, ok := c.(*envelopeCrypter)
+	if !ok {
+		return !Outdated(c, messagebytes)
+	}
+
+	envelope, ok, err := ParseEnvelope(messagebytes)
+	if err != nil || !ok {
+		return false
+	}
+
+	return envelope.Kind == e.kind && bytes.Equal(envelope.KeyID, e.keyID) && !e.Outdated(messagebytes)
+}
+
+type EnvelopeError struct {
+	Err string
+}
+
+func (e EnvelopeError) Error() string {
+	return fmt.Sprintf("crypter: %s", e.Err)
+}
+
+type KeyMismatchError struct {
+	Expected, Actual []byte
+}
+
+func (e KeyMismatchError) Error() string {
+	return fmt.Sprintf("crypter: value was encrypted with key %x, but key %x was given", e.Expected, e.Actual)
+}
@@ -0,0 +1,169 @@
+package crypter
+
+import (
+	"bytes"
+	"testing"
+)
+
+func newTestEnvelopeCrypter(t *testing.T, kind string) (Crypter, []byte) {
+	k, err := NewKey(kind)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewEnvelopeCrypter(kind, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c, k
+}
+
+func TestEnvelopeEncodeDecode(t *testing.T) {
+	for _, kind := range testKinds {
+		c, k := newTestEnvelopeCrypter(t, kind)
+
+		cipherbytes, err := c.EncryptAndSign(message)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		envelope, ok, err := ParseEnvelope(cipherbytes)
+		if err != nil || !ok {
+			t.Errorf("expected an envelope but found %v, %v!", ok, err)
+			continue
+		}
+
+		if envelope.Kind != kind {
+			t.Errorf("expected kind %s but found %s!", kind, envelope.Kind)
+		}
+		if !bytes.Equal(envelope.KeyID, KeyID(k)) {
+			t.Errorf("expected key ID %x but found %x!", KeyID(k), envelope.KeyID)
+		}
+
+		plainbytes, err := c.ValidateAndDecrypt(cipherbytes)
+		if err != nil {
+			t.Error(err)
+		} else if !bytes.Equal(plainbytes, message) {
+			t.Errorf("decoded bytes did not match! expected %q but found %q", message, plainbytes)
+		}
+	}
+}
+
+func TestEnvelopeSelectsCrypter(t *testing.T) {
+	writer, k := newTestEnvelopeCrypter(t, "gcm")
+
+	cipherbytes, err := writer.EncryptAndSign(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A gcm key can't be used to write std values.
+	if _, err := NewEnvelopeCrypter("std", k); err == nil {
+		t.Error("expected an error creating a std crypter with a gcm key!")
+	} else if _, ok := err.(KeyLengthError); !ok {
+		t.Errorf("expected a KeyLengthError but found %v!", err)
+	}
+
+	// A reader configured for another kind should still use the kind named in
+	// the envelope.
+	reader, err := NewEnvelopeReader("std", k)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plainbytes, err := reader.ValidateAndDecrypt(cipherbytes)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(plainbytes, message) {
+		t.Errorf("decoded bytes did not match! expected %q but found %q", message, plainbytes)
+	}
+
+	// Writing with a key of the wrong kind is still an error.
+	if _, err := reader.EncryptAndSign(message); err == nil {
+		t.Error("expected an error writing with a gcm key as std!")
+	}
+}
+
+func TestEnvelopeKeyMismatch(t *testing.T) {
+	for _, kind := range testKinds {
+		c1, _ := newTestEnvelopeCrypter(t, kind)
+		c2, _ := newTestEnvelopeCrypter(t, kind)
+
+		cipherbytes, err := c1.EncryptAndSign(message)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if _, err := c2.ValidateAndDecrypt(cipherbytes); err == nil {
+			t.Error("value validated with the wrong key!")
+		} else if _, ok := err.(KeyMismatchError); !ok {
+			t.Errorf("expected a KeyMismatchError but found %v!", err)
+		}
+	}
+}
+
+func TestEnvelopeBareMessages(t *testing.T) {
+	for _, kind := range testKinds {
+		k, err := NewKey(kind)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bare, err := NewCrypter(kind, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := NewEnvelopeCrypter(kind, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data := AssociatedData("context", "group", "A")
+		cipherbytes, err := EncryptAndSignWithData(bare, message, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !Outdated(c, cipherbytes) {
+			t.Errorf("bare %s message is not reported as outdated!", kind)
+		}
+		if Current(c, cipherbytes) {
+			t.Errorf("bare %s message is reported as current!", kind)
+		}
+
+		plainbytes, err := ValidateAndDecryptWithData(c, cipherbytes, data)
+		if err != nil {
+			t.Error(err)
+		} else if !bytes.Equal(plainbytes, message) {
+			t.Errorf("decoded bytes did not match! expected %q but found %q", message, plainbytes)
+		}
+
+		cipherbytes, err = EncryptAndSignWithData(c, message, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if Outdated(c, cipherbytes) {
+			t.Errorf("enveloped %s message is reported as outdated!", kind)
+		}
+		if !Current(c, cipherbytes) {
+			t.Errorf("enveloped %s message is not reported as current!", kind)
+		}
+	}
+}
+
+func TestParseEnvelopeErrors(t *testing.T) {
+	for _, messagebytes := range [][]byte{
+		EnvelopeMagic,
+		append(append([]byte{}, EnvelopeMagic...), EnvelopeVersion+1, 3),
+		append(append([]byte{}, EnvelopeMagic...), EnvelopeVersion, 3, 'g', 'c', 'm', 1, 2),
+	} {
+		if _, ok, err := ParseEnvelope(messagebytes); !ok || err == nil {
+			t.Errorf("expected an error parsing %q!", messagebytes)
+		}
+	}
+}
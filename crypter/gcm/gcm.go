@@ -0,0 +1,105 @@
+package gcm
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+)
+
+const (
+
+	// KeyLength is the length in bytes of the key used with the AES-256
+	// algorithm
+	KeyLength = 32
+)
+
+// A gcmCrypter encrypts and authenticates messages using AES-256 in GCM mode.
+// Unlike the std crypter, it can also authenticate associated data that is
+// not itself part of the message.
+type gcmCrypter struct {
+	aead cipher.AEAD
+}
+
+func New(key []byte) (*gcmCrypter, error) {
+
+	// Confirm that there are enough bytes in the key to select AES-256 and no
+	// more.
+	if len(key) != KeyLength {
+		return nil, gcmCrypterError{"key has the wrong length for AES-256 (32 bytes)"}
+	}
+
+	// As with the std crypter, we assume the resulting block does not hold a
+	// reference to the original, mutable key.
+	b, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gcmCrypter{aead: aead}, nil
+}
+
+// EncryptAndSign encrypts and authenticates plainbytes with no associated
+// data.
+func (c *gcmCrypter) EncryptAndSign(plainbytes []byte) ([]byte, error) {
+	return c.EncryptAndSignWithData(plainbytes, nil)
+}
+
+// ValidateAndDecrypt authenticates and decrypts messagebytes that were
+// produced with no associated data.
+func (c *gcmCrypter) ValidateAndDecrypt(messagebytes []byte) ([]byte, error) {
+	return c.ValidateAndDecryptWithData(messagebytes, nil)
+}
+
+// EncryptAndSignWithData encrypts plainbytes and authenticates it along with
+// data, returning a message that begins with a random nonce.
+func (c *gcmCrypter) EncryptAndSignWithData(plainbytes, data []byte) ([]byte, error) {
+
+	// Read a random nonce into the front of the message.
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(plainbytes)+c.aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	// Seal appends the cipherbytes and tag to the nonce.
+	return c.aead.Seal(nonce, nonce, plainbytes, data), nil
+}
+
+// ValidateAndDecryptWithData authenticates messagebytes along with data and
+// returns the decrypted plainbytes. Authentication fails if data differs from
+// what was given when the message was encrypted.
+func (c *gcmCrypter) ValidateAndDecryptWithData(messagebytes, data []byte) ([]byte, error) {
+
+	// Check that the message has room for a nonce and a tag.
+	if len(messagebytes) < c.aead.NonceSize()+c.aead.Overhead() {
+		return nil, gcmCrypterError{"message is too short"}
+	}
+
+	nonce := messagebytes[:c.aead.NonceSize()]
+	plainbytes, err := c.aead.Open(nil, nonce, messagebytes[c.aead.NonceSize():], data)
+	if err != nil {
+		return nil, gcmCrypterError{"message authentication failed"}
+	}
+
+	// Open returns nil rather than an empty slice for empty messages.
+	if plainbytes == nil {
+		plainbytes = []byte{}
+	}
+
+	return plainbytes, nil
+}
+
+// gcmCrypterError represents a run-time error in a gcmCrypter method.
+type gcmCrypterError struct {
+	Err string
+}
+
+func (e gcmCrypterError) Error() string {
+	return fmt.Sprintf("gcmCrypter: %s", e.Err)
+}
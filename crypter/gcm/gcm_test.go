@@ -0,0 +1,103 @@
+package gcm
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+)
+
+func randomGcmCrypter() (*gcmCrypter, error) {
+	key := make([]byte, KeyLength)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+
+	return New(key)
+}
+
+func TestEncodeDecode(t *testing.T) {
+
+	c, err := randomGcmCrypter()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	originalbytes := []byte("Test message !@#$%^&*()_1234567890{}[]✓.\x00\x00")
+
+	cipherbytes, err := c.EncryptAndSign(originalbytes)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if bytes.Contains(cipherbytes, originalbytes) {
+		t.Error("encoding the bytes didn't work!")
+	}
+
+	plainbytes, err := c.ValidateAndDecrypt(cipherbytes)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !bytes.Equal(plainbytes, originalbytes) {
+		t.Errorf("decoded bytes did not match! expected %q but found %q", originalbytes, plainbytes)
+	}
+}
+
+func TestAssociatedData(t *testing.T) {
+
+	c, err := randomGcmCrypter()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	originalbytes := []byte("Test message")
+
+	cipherbytes, err := c.EncryptAndSignWithData(originalbytes, []byte("group A"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plainbytes, err := c.ValidateAndDecryptWithData(cipherbytes, []byte("group A"))
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(plainbytes, originalbytes) {
+		t.Errorf("decoded bytes did not match! expected %q but found %q", originalbytes, plainbytes)
+	}
+
+	if _, err := c.ValidateAndDecryptWithData(cipherbytes, []byte("group B")); err == nil {
+		t.Error("message validated with the wrong associated data!")
+	}
+
+	if _, err := c.ValidateAndDecrypt(cipherbytes); err == nil {
+		t.Error("message validated without its associated data!")
+	}
+}
+
+func TestTamperedMessage(t *testing.T) {
+
+	c, err := randomGcmCrypter()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cipherbytes, err := c.EncryptAndSign([]byte("Test message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cipherbytes[len(cipherbytes)-1] ^= 1
+	if _, err := c.ValidateAndDecrypt(cipherbytes); err == nil {
+		t.Error("tampered message validated!")
+	}
+
+	if _, err := c.ValidateAndDecrypt(cipherbytes[:4]); err == nil {
+		t.Error("truncated message validated!")
+	}
+}
+
+func TestWrongKeyLength(t *testing.T) {
+	if _, err := New(make([]byte, KeyLength-1)); err == nil {
+		t.Error("expected an error for a short key!")
+	}
+}
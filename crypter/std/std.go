@@ -20,6 +20,11 @@ const (
 	// HmacKeyLength is the length in bytes of the key used in the HMAC
 	// SHA-512 algorithm
 	HmacKeyLength = 128
+
+	// FormatVersion is written after the signature of every message. The
+	// original format has no version byte and pads with zeros, which can't be
+	// removed unambiguously. Version 2 uses PKCS#7 padding.
+	FormatVersion byte = 2
 )
 
 // A stdCrypter is an enstdCrypter/destdCrypter set to use a specific encryption key (for
@@ -69,20 +74,19 @@ func (c *stdCrypter) hmac(message []byte) []byte {
 }
 
 // encrypt encrypts a slice of bytes using the AES-256 cipher in CBC mode and
-// returns an usigned sice of cipher bytes that begins with the IV.
+// returns an usigned sice of cipher bytes that begins with the IV. The
+// plainbytes are padded using PKCS#7.
 func (c *stdCrypter) encrypt(plainbytes []byte) ([]byte, error) {
 
-	// Initialize size with room for the IV.
-	size := aes.BlockSize + len(plainbytes)
-
-	// Add extra padding if the size is not a multiple of the Block size.
-	if extra := len(plainbytes) % aes.BlockSize; extra != 0 {
-		size += aes.BlockSize - extra
-	}
+	// There is always at least one byte of padding, and as much as a whole
+	// Block, so that the padding can be identified when decrypting.
+	padding := aes.BlockSize - len(plainbytes)%aes.BlockSize
 
-	// Create the cipherbytes slice and copy in the plainbytes.
-	cipherbytes := make([]byte, size)
+	// Create the cipherbytes slice with room for the IV, and copy in the
+	// plainbytes followed by the padding.
+	cipherbytes := make([]byte, aes.BlockSize+len(plainbytes)+padding)
 	copy(cipherbytes[aes.BlockSize:], plainbytes)
+	copy(cipherbytes[aes.BlockSize+len(plainbytes):], bytes.Repeat([]byte{byte(padding)}, padding))
 
 	// Use an IV at the front of the cipherbytes, and attempt to read in random bits.
 	iv := cipherbytes[:aes.BlockSize]
@@ -98,9 +102,10 @@ func (c *stdCrypter) encrypt(plainbytes []byte) ([]byte, error) {
 }
 
 // decrypt decrypts a slice of cipherbytes using the AES-256 cipher in CBC
-// mode and returns a slice of plain bytes. The first Block of the cipherbytes
-// argument is expected to be the IV. It does not verify or expect a signature
-// to be present in the cipherbytes argument.
+// mode and returns a slice of plain bytes that still includes any padding.
+// The first Block of the cipherbytes argument is expected to be the IV. It
+// does not verify or expect a signature to be present in the cipherbytes
+// argument.
 func (c *stdCrypter) decrypt(cipherbytes []byte) ([]byte, error) {
 
 	// We need an IV and at least one Block of cipherbytes to proceed.
@@ -119,16 +124,43 @@ func (c *stdCrypter) decrypt(cipherbytes []byte) ([]byte, error) {
 	// Allocate a new byte array to hold the plainbytes
 	plainbytes := make([]byte, len(cipherbytes)-aes.BlockSize)
 
-	// Decrypt the cipherbytes and trim the result.
+	// Decrypt the cipherbytes.
 	mode := cipher.NewCBCDecrypter(c.block, iv)
 	mode.CryptBlocks(plainbytes, cipherbytes[aes.BlockSize:])
-	plainbytes = bytes.TrimRight(plainbytes, "\x00")
 
 	return plainbytes, nil
 }
 
+// unpad removes and checks PKCS#7 padding.
+func unpad(plainbytes []byte) ([]byte, error) {
+	if len(plainbytes) == 0 {
+		return nil, stdCrypterError{"missing padding"}
+	}
+
+	padding := int(plainbytes[len(plainbytes)-1])
+	if padding == 0 || padding > aes.BlockSize || padding > len(plainbytes) {
+		return nil, stdCrypterError{"invalid padding"}
+	}
+
+	for _, b := range plainbytes[len(plainbytes)-padding:] {
+		if int(b) != padding {
+			return nil, stdCrypterError{"invalid padding"}
+		}
+	}
+
+	return plainbytes[:len(plainbytes)-padding], nil
+}
+
+// isLegacy reports whether the signed portion of a message uses the original
+// format. The original format is always a whole number of Blocks, while the
+// current format adds a single version byte.
+func isLegacy(signedbytes []byte) bool {
+	return len(signedbytes)%aes.BlockSize == 0
+}
+
 // EncryptAndSign converts plainbytes to signed cipherbytes by encrypting the
-// plainbytes using AES-256 and prepending a Hmac SHA-512 signature.
+// plainbytes using AES-256 and prepending a format version and a Hmac SHA-512
+// signature.
 func (c *stdCrypter) EncryptAndSign(plainbytes []byte) ([]byte, error) {
 
 	// Encrypt the slice of plainbytes, producing cipherbytes.
@@ -137,39 +169,63 @@ func (c *stdCrypter) EncryptAndSign(plainbytes []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	// Get the signatrue for the cipherbytes.
-	hmacbytes := c.hmac(cipherbytes)
+	// Copy the version and cipherbytes into a single byte string, leaving
+	// room for the signature at the front.
+	messagebytes := make([]byte, sha512.Size+1+len(cipherbytes))
+	messagebytes[sha512.Size] = FormatVersion
+	copy(messagebytes[sha512.Size+1:], cipherbytes)
 
-	// Copy all the bytes into a single byte string.
-	messagebytes := make([]byte, sha512.Size+len(cipherbytes))
-	copy(messagebytes[:len(hmacbytes)], hmacbytes)
-	copy(messagebytes[len(hmacbytes):], cipherbytes)
+	// Sign the version along with the cipherbytes, so that neither can be
+	// changed independently.
+	copy(messagebytes[:sha512.Size], c.hmac(messagebytes[sha512.Size:]))
 
 	return messagebytes, nil
 }
 
 // Decrypt converts signed slice of cipherbytes to plainbytes by first
 // validating a prepended Hmac SHA-512 signature and then decrypting the
-// remaining message using AES-256.
+// remaining message using AES-256. Messages in the original, unversioned
+// format are still accepted.
 func (c *stdCrypter) ValidateAndDecrypt(messagebytes []byte) ([]byte, error) {
 
 	// Check that message bytes is long enough.
-	if len(messagebytes) < 64 {
+	if len(messagebytes) < sha512.Size {
 		return nil, stdCrypterError{"message signature is too short"}
 	}
 
 	// Check the signature.
-	if hmac.Equal(messagebytes[:64], c.hmac(messagebytes[64:])) != true {
+	signedbytes := messagebytes[sha512.Size:]
+	if hmac.Equal(messagebytes[:sha512.Size], c.hmac(signedbytes)) != true {
 		return nil, stdCrypterError{"invalid signature"}
 	}
 
+	// The original format was padded with zeros, which we can only trim.
+	if isLegacy(signedbytes) {
+		plainbytes, err := c.decrypt(signedbytes)
+		if err != nil {
+			return nil, err
+		}
+
+		return bytes.TrimRight(plainbytes, "\x00"), nil
+	}
+
+	if len(signedbytes) == 0 || signedbytes[0] != FormatVersion {
+		return nil, stdCrypterError{"unknown format version"}
+	}
+
 	// Decode the encrypted bytes.
-	plainbytes, err := c.decrypt(messagebytes[64:])
+	plainbytes, err := c.decrypt(signedbytes[1:])
 	if err != nil {
 		return nil, err
 	}
 
-	return plainbytes, nil
+	return unpad(plainbytes)
+}
+
+// Outdated reports whether a message uses the original, zero-padded format
+// and should be rewritten. It does not validate the message.
+func (c *stdCrypter) Outdated(messagebytes []byte) bool {
+	return len(messagebytes) >= sha512.Size && isLegacy(messagebytes[sha512.Size:])
 }
 
 // stdCrypterError represents a run-time error in a stdCrypter method.
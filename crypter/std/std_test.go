@@ -2,6 +2,8 @@ package std
 
 import (
 	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
 	"io"
 	"testing"
@@ -40,7 +42,106 @@ func TestEncodeDecode(t *testing.T) {
 	}
 
 	if !bytes.Equal(plainbytes, originalbytes) {
-		t.Errorf("decoded bytes did not match!", originalbytes, plainbytes)
+		t.Errorf("decoded bytes did not match! expected %q but found %q", originalbytes, plainbytes)
+	}
+}
+
+// legacyEncryptAndSign produces a message in the original, unversioned
+// format, which padded plainbytes with zeros.
+func legacyEncryptAndSign(c *stdCrypter, plainbytes []byte) ([]byte, error) {
+	size := aes.BlockSize + len(plainbytes)
+	if extra := len(plainbytes) % aes.BlockSize; extra != 0 {
+		size += aes.BlockSize - extra
+	}
+
+	cipherbytes := make([]byte, size)
+	copy(cipherbytes[aes.BlockSize:], plainbytes)
+
+	iv := cipherbytes[:aes.BlockSize]
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+
+	mode := cipher.NewCBCEncrypter(c.block, iv)
+	mode.CryptBlocks(cipherbytes[aes.BlockSize:], cipherbytes[aes.BlockSize:])
+
+	return append(c.hmac(cipherbytes), cipherbytes...), nil
+}
+
+func TestTrailingNulBytes(t *testing.T) {
+
+	c, err := randomStdCrypter()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cover a value ending on a Block boundary as well as one that doesn't.
+	for _, originalbytes := range [][]byte{
+		[]byte("binary\x00\x00"),
+		append(bytes.Repeat([]byte{1}, aes.BlockSize-1), 0),
+		[]byte{0},
+		[]byte{},
+	} {
+		cipherbytes, err := c.EncryptAndSign(originalbytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if c.Outdated(cipherbytes) {
+			t.Error("new message is reported as outdated!")
+		}
+
+		plainbytes, err := c.ValidateAndDecrypt(cipherbytes)
+		if err != nil {
+			t.Error(err)
+		} else if !bytes.Equal(plainbytes, originalbytes) {
+			t.Errorf("decoded bytes did not match! expected %q but found %q", originalbytes, plainbytes)
+		}
+	}
+}
+
+func TestLegacyFormat(t *testing.T) {
+
+	c, err := randomStdCrypter()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	originalbytes := []byte("Test message !@#$%^&*()_1234567890{}[]✓.")
+
+	cipherbytes, err := legacyEncryptAndSign(c, originalbytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !c.Outdated(cipherbytes) {
+		t.Error("legacy message is not reported as outdated!")
+	}
+
+	plainbytes, err := c.ValidateAndDecrypt(cipherbytes)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(plainbytes, originalbytes) {
+		t.Errorf("decoded bytes did not match! expected %q but found %q", originalbytes, plainbytes)
+	}
+}
+
+func TestTamperedVersion(t *testing.T) {
+
+	c, err := randomStdCrypter()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cipherbytes, err := c.EncryptAndSign([]byte("Test message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The version byte is covered by the signature.
+	cipherbytes[64] = FormatVersion + 1
+	if _, err := c.ValidateAndDecrypt(cipherbytes); err == nil {
+		t.Error("message with a modified version validated!")
 	}
 }
 
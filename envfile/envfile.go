@@ -0,0 +1,150 @@
+// Package envfile reads and writes environments in the file formats used by
+// other tools.
+package envfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Formats lists the formats that Write supports.
+var Formats = []string{"dotenv", "docker", "json", "yaml", "shell", "systemd"}
+
+var (
+	namePattern   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	simplePattern = regexp.MustCompile(`^[A-Za-z0-9_./:@%+,=-]*$`)
+)
+
+// Write writes env to w in the given format, sorted by name so that output
+// is reproducible.
+func Write(w io.Writer, format string, env map[string]string) error {
+	names := make([]string, 0, len(env))
+	for name, value := range env {
+
+		// None of the formats can represent a NUL byte, and the text formats
+		// can't represent invalid UTF-8 either.
+		if !utf8.ValidString(value) || strings.IndexByte(value, 0) >= 0 {
+			return ValueError{name, "value is not valid text"}
+		}
+
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	switch format {
+	case "dotenv":
+		for _, name := range names {
+			if !namePattern.MatchString(name) {
+				return ValueError{name, "name is not a valid identifier"}
+			}
+			fmt.Fprintf(&buf, "%s=%s\n", name, quoteDotenv(env[name]))
+		}
+	case "docker":
+
+		// docker run --env-file takes everything after the = literally, up
+		// to the end of the line, so values are written as they are.
+		for _, name := range names {
+			if !namePattern.MatchString(name) {
+				return ValueError{name, "name is not a valid identifier"}
+			}
+			if strings.ContainsAny(env[name], "\n\r") {
+				return ValueError{name, "docker env files can't hold values with newlines"}
+			}
+			fmt.Fprintf(&buf, "%s=%s\n", name, env[name])
+		}
+	case "json":
+		encoded, err := json.MarshalIndent(env, "", "  ")
+		if err != nil {
+			return err
+		}
+		buf.Write(encoded)
+		buf.WriteByte('\n')
+	case "yaml":
+		for _, name := range names {
+			key := name
+			if !namePattern.MatchString(name) {
+				key = quoteJSON(name)
+			}
+			fmt.Fprintf(&buf, "%s: %s\n", key, quoteJSON(env[name]))
+		}
+	case "shell":
+		for _, name := range names {
+			if !namePattern.MatchString(name) {
+				return ValueError{name, "name is not a valid shell identifier"}
+			}
+			fmt.Fprintf(&buf, "export %s=%s\n", name, quoteShell(env[name]))
+		}
+	case "systemd":
+		for _, name := range names {
+			if !namePattern.MatchString(name) {
+				return ValueError{name, "name is not a valid identifier"}
+			}
+			fmt.Fprintf(&buf, "%s=%s\n", name, quoteSystemd(env[name]))
+		}
+	default:
+		return UnknownFormatError{format}
+	}
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// quoteDotenv leaves simple values bare and single-quotes values that can be
+// represented literally, which dotenv implementations don't interpolate.
+// Anything else is double-quoted with escapes.
+func quoteDotenv(value string) string {
+	if simplePattern.MatchString(value) {
+		return value
+	}
+
+	if !strings.ContainsAny(value, "'\n\r") {
+		return "'" + value + "'"
+	}
+
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+	return `"` + r.Replace(value) + `"`
+}
+
+// quoteJSON returns value as a JSON string, which is also a valid YAML
+// double-quoted scalar.
+func quoteJSON(value string) string {
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
+
+// quoteShell single-quotes value for a POSIX shell, where nothing inside
+// single quotes is special except the closing quote itself.
+func quoteShell(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
+// quoteSystemd double-quotes value for a systemd EnvironmentFile, escaping
+// the characters that are special inside double quotes. Newlines are kept as
+// they are, since systemd reads quoted values across lines.
+func quoteSystemd(value string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`", `$`, `\$`)
+	return `"` + r.Replace(value) + `"`
+}
+
+type UnknownFormatError struct {
+	Format string
+}
+
+func (e UnknownFormatError) Error() string {
+	return fmt.Sprintf("envfile: format \"%s\" has not been implemented", e.Format)
+}
+
+type ValueError struct {
+	Name, Err string
+}
+
+func (e ValueError) Error() string {
+	return fmt.Sprintf("envfile: %s: %s", e.Name, e.Err)
+}
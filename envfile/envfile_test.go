@@ -0,0 +1,99 @@
+package envfile
+
+import (
+	"bytes"
+	"testing"
+)
+
+var testEnv = map[string]string{
+	"SIMPLE":    "postgres://user@host:5432/db",
+	"EMPTY":     "",
+	"SPACES":    "two words $HOME",
+	"QUOTES":    `it's "quoted"`,
+	"MULTILINE": "line one\nline two",
+}
+
+var testWrites = []struct {
+	Format, Expected string
+}{
+	{"dotenv", `EMPTY=
+MULTILINE="line one\nline two"
+QUOTES="it's \"quoted\""
+SIMPLE=postgres://user@host:5432/db
+SPACES='two words $HOME'
+`},
+	{"json", `{
+  "EMPTY": "",
+  "MULTILINE": "line one\nline two",
+  "QUOTES": "it's \"quoted\"",
+  "SIMPLE": "postgres://user@host:5432/db",
+  "SPACES": "two words $HOME"
+}
+`},
+	{"yaml", `EMPTY: ""
+MULTILINE: "line one\nline two"
+QUOTES: "it's \"quoted\""
+SIMPLE: "postgres://user@host:5432/db"
+SPACES: "two words $HOME"
+`},
+	{"shell", `export EMPTY=''
+export MULTILINE='line one
+line two'
+export QUOTES='it'\''s "quoted"'
+export SIMPLE='postgres://user@host:5432/db'
+export SPACES='two words $HOME'
+`},
+	{"systemd", `EMPTY=""
+MULTILINE="line one
+line two"
+QUOTES="it's \"quoted\""
+SIMPLE="postgres://user@host:5432/db"
+SPACES="two words \$HOME"
+`},
+}
+
+func TestWrite(t *testing.T) {
+	for _, test := range testWrites {
+		var buf bytes.Buffer
+		if err := Write(&buf, test.Format, testEnv); err != nil {
+			t.Errorf("%s: %s", test.Format, err)
+			continue
+		}
+
+		if buf.String() != test.Expected {
+			t.Errorf("%s: expected\n%s\nbut found\n%s", test.Format, test.Expected, buf.String())
+		}
+	}
+}
+
+func TestWriteDocker(t *testing.T) {
+	var buf bytes.Buffer
+	env := map[string]string{"QUOTES": `it's "quoted"`, "SPACES": "two words $HOME"}
+	if err := Write(&buf, "docker", env); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "QUOTES=it's \"quoted\"\nSPACES=two words $HOME\n"; buf.String() != expected {
+		t.Errorf("expected\n%s\nbut found\n%s", expected, buf.String())
+	}
+
+	if err := Write(&bytes.Buffer{}, "docker", testEnv); err == nil {
+		t.Error("expected an error for a multiline value!")
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	for _, format := range Formats {
+		if err := Write(&bytes.Buffer{}, format, map[string]string{"BINARY": "\x00\xff"}); err == nil {
+			t.Errorf("%s: expected an error for a binary value!", format)
+		}
+	}
+
+	if err := Write(&bytes.Buffer{}, "shell", map[string]string{"NOT-A-NAME": "value"}); err == nil {
+		t.Error("expected an error for an invalid shell name!")
+	}
+
+	if err := Write(&bytes.Buffer{}, "xml", testEnv); err == nil {
+		t.Error("expected an error for an unknown format!")
+	}
+}
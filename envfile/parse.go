@@ -0,0 +1,256 @@
+package envfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// ParseFormats lists the formats that Parse supports.
+var ParseFormats = []string{"dotenv", "json"}
+
+// FormatForPath guesses the format of the file at path from its extension.
+func FormatForPath(path string) string {
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		return "json"
+	}
+	return "dotenv"
+}
+
+// Parse reads an environment in the given format from r.
+func Parse(r io.Reader, format string) (map[string]string, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case "dotenv":
+		return parseDotenv(string(data))
+	case "json":
+		return parseJSON(data)
+	}
+
+	return nil, UnknownFormatError{format}
+}
+
+// parseJSON reads a flat JSON object. Numbers and booleans are accepted and
+// kept as they were written.
+func parseJSON(data []byte) (map[string]string, error) {
+	var object map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&object); err != nil {
+		return nil, err
+	}
+
+	env := make(map[string]string, len(object))
+	for name, value := range object {
+		switch v := value.(type) {
+		case string:
+			env[name] = v
+		case json.Number:
+			env[name] = v.String()
+		case bool:
+			env[name] = fmt.Sprint(v)
+		default:
+			return nil, ValueError{name, "value must be a string, number or boolean"}
+		}
+	}
+
+	return env, nil
+}
+
+// A dotenvParser reads the common dotenv syntax: NAME=value lines with an
+// optional export prefix, comments, and single- or double-quoted values that
+// may span several lines.
+type dotenvParser struct {
+	input string
+	pos   int
+	line  int
+}
+
+func parseDotenv(input string) (map[string]string, error) {
+	p := &dotenvParser{input: input, line: 1}
+	env := make(map[string]string)
+
+	for {
+		p.skipSpace()
+		if p.done() {
+			return env, nil
+		}
+
+		// Skip blank lines and comments.
+		if c := p.peek(); c == '\n' || c == '#' {
+			p.skipLine()
+			continue
+		}
+
+		name := p.word()
+		if name == "export" {
+			p.skipSpace()
+			if !p.done() && isNameByte(p.peek()) {
+				name = p.word()
+			}
+		}
+
+		if !namePattern.MatchString(name) {
+			return nil, p.errorf("invalid variable name \"%s\"", name)
+		}
+
+		p.skipSpace()
+		if p.done() || p.peek() != '=' {
+			return nil, p.errorf("expected = after %s", name)
+		}
+		p.pos++
+		p.skipSpace()
+
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		env[name] = value
+
+		// Only a comment may follow a value on its line.
+		p.skipSpace()
+		if !p.done() && p.peek() != '\n' && p.peek() != '#' {
+			return nil, p.errorf("unexpected text after the value of %s", name)
+		}
+		p.skipLine()
+	}
+}
+
+func (p *dotenvParser) done() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *dotenvParser) peek() byte {
+	return p.input[p.pos]
+}
+
+func (p *dotenvParser) next() byte {
+	c := p.input[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+	return c
+}
+
+func (p *dotenvParser) skipSpace() {
+	for !p.done() && (p.peek() == ' ' || p.peek() == '\t' || p.peek() == '\r') {
+		p.pos++
+	}
+}
+
+func (p *dotenvParser) skipLine() {
+	for !p.done() && p.next() != '\n' {
+	}
+}
+
+func isNameByte(c byte) bool {
+	return c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9'
+}
+
+func (p *dotenvParser) word() string {
+	start := p.pos
+	for !p.done() && isNameByte(p.peek()) {
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+func (p *dotenvParser) value() (string, error) {
+	if p.done() {
+		return "", nil
+	}
+
+	switch p.peek() {
+	case '\'':
+		return p.singleQuoted()
+	case '"':
+		return p.doubleQuoted()
+	}
+
+	// An unquoted value runs to the end of the line or to a comment, which
+	// must be preceded by whitespace.
+	start := p.pos
+	for !p.done() && p.peek() != '\n' {
+		if p.peek() == '#' && p.pos > start && (p.input[p.pos-1] == ' ' || p.input[p.pos-1] == '\t') {
+			break
+		}
+		p.pos++
+	}
+	return strings.TrimRight(p.input[start:p.pos], " \t\r"), nil
+}
+
+// singleQuoted reads a value literally up to the closing quote.
+func (p *dotenvParser) singleQuoted() (string, error) {
+	line := p.line
+	p.pos++
+
+	var buf bytes.Buffer
+	for !p.done() {
+		c := p.next()
+		if c == '\'' {
+			return buf.String(), nil
+		}
+		buf.WriteByte(c)
+	}
+
+	return "", ParseError{line, "unterminated single-quoted value"}
+}
+
+// doubleQuoted reads a value up to the closing quote, interpreting backslash
+// escapes.
+func (p *dotenvParser) doubleQuoted() (string, error) {
+	line := p.line
+	p.pos++
+
+	var buf bytes.Buffer
+	for !p.done() {
+		c := p.next()
+		switch c {
+		case '"':
+			return buf.String(), nil
+		case '\\':
+			if p.done() {
+				break
+			}
+			switch e := p.next(); e {
+			case 'n':
+				buf.WriteByte('\n')
+			case 'r':
+				buf.WriteByte('\r')
+			case 't':
+				buf.WriteByte('\t')
+			case '\n':
+
+				// A backslash at the end of a line continues the value.
+			default:
+				buf.WriteByte(e)
+			}
+		default:
+			buf.WriteByte(c)
+		}
+	}
+
+	return "", ParseError{line, "unterminated double-quoted value"}
+}
+
+func (p *dotenvParser) errorf(format string, args ...interface{}) error {
+	return ParseError{p.line, fmt.Sprintf(format, args...)}
+}
+
+type ParseError struct {
+	Line int
+	Err  string
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf("envfile: line %d: %s", e.Line, e.Err)
+}
@@ -0,0 +1,107 @@
+package envfile
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testDotenv = `# A comment.
+SIMPLE=postgres://user@host:5432/db
+export EXPORTED=yes
+SPACED = value with spaces   # and a comment
+HASH=no#comment
+EMPTY=
+SINGLE='literal $HOME \n'
+DOUBLE="escaped \"quotes\"\tand\nnewlines"
+MULTILINE="-----BEGIN KEY-----
+abc
+-----END KEY-----"
+
+CRLF=windows` + "\r" + `
+`
+
+func TestParseDotenv(t *testing.T) {
+	env, err := Parse(strings.NewReader(testDotenv), "dotenv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"SIMPLE":    "postgres://user@host:5432/db",
+		"EXPORTED":  "yes",
+		"SPACED":    "value with spaces",
+		"HASH":      "no#comment",
+		"EMPTY":     "",
+		"SINGLE":    `literal $HOME \n`,
+		"DOUBLE":    "escaped \"quotes\"\tand\nnewlines",
+		"MULTILINE": "-----BEGIN KEY-----\nabc\n-----END KEY-----",
+		"CRLF":      "windows",
+	}
+
+	if !reflect.DeepEqual(env, expected) {
+		t.Errorf("expected %q but found %q!", expected, env)
+	}
+}
+
+func TestParseDotenvErrors(t *testing.T) {
+	for _, input := range []string{
+		"NO_EQUALS\n",
+		"1NAME=value\n",
+		"UNTERMINATED='value\n",
+		"UNTERMINATED=\"value\n",
+		"TRAILING=\"value\" text\n",
+	} {
+		if _, err := Parse(strings.NewReader(input), "dotenv"); err == nil {
+			t.Errorf("expected an error parsing %q!", input)
+		} else if _, ok := err.(ParseError); !ok {
+			t.Errorf("expected a ParseError but found %v!", err)
+		}
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	env, err := Parse(strings.NewReader(`{"A": "one", "B": 2, "C": true}`), "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{"A": "one", "B": "2", "C": "true"}
+	if !reflect.DeepEqual(env, expected) {
+		t.Errorf("expected %q but found %q!", expected, env)
+	}
+
+	if _, err := Parse(strings.NewReader(`{"A": {"nested": true}}`), "json"); err == nil {
+		t.Error("expected an error for a nested object!")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range ParseFormats {
+		var buf bytes.Buffer
+		if err := Write(&buf, format, testEnv); err != nil {
+			t.Fatal(err)
+		}
+
+		env, err := Parse(&buf, format)
+		if err != nil {
+			t.Errorf("%s: %s", format, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(env, testEnv) {
+			t.Errorf("%s: expected %q but found %q!", format, testEnv, env)
+		}
+	}
+}
+
+func TestFormatForPath(t *testing.T) {
+	if format := FormatForPath("config/app.JSON"); format != "json" {
+		t.Errorf("expected json but found %s!", format)
+	}
+
+	if format := FormatForPath(".env"); format != "dotenv" {
+		t.Errorf("expected dotenv but found %s!", format)
+	}
+}
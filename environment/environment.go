@@ -0,0 +1,93 @@
+// Package environment builds the environments that commands are run with.
+package environment
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// An Environment maps variable names to values.
+type Environment map[string]string
+
+// Parse reads an environment in the form returned by os.Environ. Each entry
+// is split at its first =, so values may contain = themselves. Entries
+// without a name or an = are ignored.
+//
+// An Environment holds one value for each name, so where a name appears more
+// than once only the first entry is kept. That is the value getenv, and so
+// the command, would have seen, and Environ writes each name once.
+func Parse(environ []string) Environment {
+	env := make(Environment, len(environ))
+	for _, entry := range environ {
+		i := strings.IndexByte(entry, '=')
+		if i <= 0 {
+			continue
+		}
+
+		name, value := entry[:i], entry[i+1:]
+		if _, ok := env[name]; !ok {
+			env[name] = value
+		}
+	}
+
+	return env
+}
+
+// Filter returns the variables for which match returns true.
+func (e Environment) Filter(match func(name string) bool) Environment {
+	filtered := make(Environment, len(e))
+	for name, value := range e {
+		if match(name) {
+			filtered[name] = value
+		}
+	}
+	return filtered
+}
+
+// Merge sets every variable in other, overriding any already set.
+func (e Environment) Merge(other map[string]string) {
+	for name, value := range other {
+		e[name] = value
+	}
+}
+
+// Names returns the names of the variables in order.
+func (e Environment) Names() []string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Environ returns the environment in the form expected by syscall.Exec and
+// os/exec, in order of name so that runs are reproducible. Variables that
+// can't be represented are reported rather than passed on mangled.
+func (e Environment) Environ() ([]string, error) {
+	environ := make([]string, 0, len(e))
+	for _, name := range e.Names() {
+		value := e[name]
+		if name == "" || strings.IndexByte(name, '=') >= 0 || strings.IndexByte(name, 0) >= 0 {
+			return nil, VariableError{name, "invalid name"}
+		}
+
+		if strings.IndexByte(value, 0) >= 0 {
+			return nil, VariableError{name, "value contains a NUL byte"}
+		}
+
+		environ = append(environ, name+"="+value)
+	}
+
+	return environ, nil
+}
+
+type VariableError struct {
+	Name string
+	Err  string
+}
+
+func (e VariableError) Error() string {
+	return fmt.Sprintf("environment: variable \"%s\": %s", e.Name, e.Err)
+}
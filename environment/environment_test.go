@@ -0,0 +1,66 @@
+package environment
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	env := Parse([]string{
+		"A=1",
+		"B=dXNlcjpwYXNz==",
+		"C=postgres://host/db?sslmode=require",
+		"A=2",
+		"EMPTY=",
+		"NO_EQUALS",
+		"",
+		"=NO_NAME",
+	})
+
+	// The first of the duplicate entries for A wins.
+	expected := Environment{
+		"A":     "1",
+		"B":     "dXNlcjpwYXNz==",
+		"C":     "postgres://host/db?sslmode=require",
+		"EMPTY": "",
+	}
+
+	if !reflect.DeepEqual(env, expected) {
+		t.Errorf("expected %q but found %q!", expected, env)
+	}
+}
+
+func TestEnviron(t *testing.T) {
+	env := Environment{"B": "x=y", "A": "1", "C": ""}
+	env.Merge(map[string]string{"A": "2"})
+
+	environ, err := env.Environ()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []string{"A=2", "B=x=y", "C="}; !reflect.DeepEqual(environ, expected) {
+		t.Errorf("expected %q but found %q!", expected, environ)
+	}
+
+	// What Environ produces, Parse reads back.
+	if parsed := Parse(environ); !reflect.DeepEqual(parsed, env) {
+		t.Errorf("expected %q but found %q!", env, parsed)
+	}
+
+	for _, env := range []Environment{{"": "1"}, {"A=B": "1"}, {"A": "1\x002"}} {
+		if _, err := env.Environ(); err == nil {
+			t.Errorf("expected an error for %q!", env)
+		} else if _, ok := err.(VariableError); !ok {
+			t.Errorf("expected a VariableError but found %v!", err)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	env := Environment{"A": "1", "B": "2"}
+	filtered := env.Filter(func(name string) bool { return name == "A" })
+	if expected := (Environment{"A": "1"}); !reflect.DeepEqual(filtered, expected) {
+		t.Errorf("expected %q but found %q!", expected, filtered)
+	}
+}
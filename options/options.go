@@ -0,0 +1,253 @@
+// Package options resolves the settings shared by every command: where the
+// backend is, how values are encrypted and which group to use.
+//
+// Settings come from, in increasing order of precedence, the defaults below,
+// the system configuration file, the user's configuration file, the selected
+// profile in either file, and CONTEXT_* environment variables. Commands apply
+// their flags on top.
+//
+// Configuration files hold one "name = value" setting per line, with # and ;
+// starting comments. Settings before any section apply to every profile, and
+// a [name] section holds the settings of a profile:
+//
+//	backend = consul
+//	address = http://127.0.0.1:8500
+//
+//	[staging]
+//	address = http://consul.staging.example.com:8500
+//	key_path = /etc/context/staging.key
+package options
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The names of the settings, as used in configuration files. The matching
+// environment variable is EnvPrefix followed by the name in upper case.
+const (
+	Address   = "address"
+	Namespace = "namespace"
+	Protocol  = "protocol"
+	Backend   = "backend"
+	Crypter   = "crypter"
+	KeyPath   = "key_path"
+	Group     = "group"
+)
+
+const (
+	DefaultAddress   = "http://127.0.0.1:4001"
+	DefaultNamespace = "context"
+	DefaultProtocol  = "tcp"
+	DefaultBackend   = "etcd"
+	DefaultCrypter   = "std"
+	DefaultKeyPath   = "/etc/context/key"
+	DefaultGroup     = "default"
+
+	EnvPrefix = "CONTEXT_"
+
+	// ProfileEnv selects a profile when none is given as a flag, and
+	// ConfigEnv names the user's configuration file in place of the usual
+	// one.
+	ProfileEnv = EnvPrefix + "PROFILE"
+	ConfigEnv  = EnvPrefix + "CONFIG"
+)
+
+// SystemConfigPath is the configuration file shared by every user. It is a
+// variable so that tests can keep the host's configuration out.
+var SystemConfigPath = "/etc/context/config"
+
+// Defaults holds the value of each setting when nothing else gives one.
+var Defaults = map[string]string{
+	Address:   DefaultAddress,
+	Namespace: DefaultNamespace,
+	Protocol:  DefaultProtocol,
+	Backend:   DefaultBackend,
+	Crypter:   DefaultCrypter,
+	KeyPath:   DefaultKeyPath,
+	Group:     DefaultGroup,
+}
+
+// A Config is a parsed configuration file.
+type Config struct {
+	Settings map[string]string
+	Profiles map[string]map[string]string
+}
+
+// ParseConfig reads a configuration file from r.
+func ParseConfig(r io.Reader) (*Config, error) {
+	config := &Config{
+		Settings: make(map[string]string),
+		Profiles: make(map[string]map[string]string),
+	}
+
+	settings := config.Settings
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if line[0] == '[' {
+			if line[len(line)-1] != ']' {
+				return nil, ConfigError{n, "unterminated profile name"}
+			}
+
+			profile := strings.TrimSpace(line[1 : len(line)-1])
+			if profile == "" {
+				return nil, ConfigError{n, "empty profile name"}
+			}
+
+			if config.Profiles[profile] == nil {
+				config.Profiles[profile] = make(map[string]string)
+			}
+			settings = config.Profiles[profile]
+			continue
+		}
+
+		i := strings.IndexByte(line, '=')
+		if i < 0 {
+			return nil, ConfigError{n, "expected name = value"}
+		}
+
+		name := strings.TrimSpace(line[:i])
+		if _, ok := Defaults[name]; !ok {
+			return nil, ConfigError{n, fmt.Sprintf("unknown setting \"%s\"", name)}
+		}
+
+		value := strings.TrimSpace(line[i+1:])
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		settings[name] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// ReadConfig reads the configuration file at path. A missing file is the
+// same as an empty one.
+func ReadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	config, err := ParseConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return config, nil
+}
+
+// UserConfigPath returns the path of the user's configuration file, which
+// is $CONTEXT_CONFIG if set, and otherwise context/config in the user's
+// configuration directory.
+func UserConfigPath() string {
+	if path := os.Getenv(ConfigEnv); path != "" {
+		return path
+	}
+
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(dir, "context", "config")
+}
+
+// Resolve returns every setting for the given profile, or for the profile
+// named by $CONTEXT_PROFILE if profile is empty, reading the system and user
+// configuration files.
+func Resolve(profile string) (map[string]string, error) {
+	var configs []*Config
+	for _, path := range []string{SystemConfigPath, UserConfigPath()} {
+		if path == "" {
+			continue
+		}
+
+		config, err := ReadConfig(path)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, config)
+	}
+
+	return resolve(configs, profile, os.LookupEnv)
+}
+
+func resolve(configs []*Config, profile string, lookupEnv func(string) (string, bool)) (map[string]string, error) {
+	settings := make(map[string]string, len(Defaults))
+	for name, value := range Defaults {
+		settings[name] = value
+	}
+
+	for _, config := range configs {
+		for name, value := range config.Settings {
+			settings[name] = value
+		}
+	}
+
+	if profile == "" {
+		profile, _ = lookupEnv(ProfileEnv)
+	}
+
+	if profile != "" {
+		found := false
+		for _, config := range configs {
+			if profileSettings, ok := config.Profiles[profile]; ok {
+				found = true
+				for name, value := range profileSettings {
+					settings[name] = value
+				}
+			}
+		}
+
+		if !found {
+			return nil, UnknownProfileError{profile}
+		}
+	}
+
+	for name := range Defaults {
+		if value, ok := lookupEnv(EnvPrefix + strings.ToUpper(name)); ok {
+			settings[name] = value
+		}
+	}
+
+	return settings, nil
+}
+
+type ConfigError struct {
+	Line int
+	Err  string
+}
+
+func (e ConfigError) Error() string {
+	return fmt.Sprintf("options: line %d: %s", e.Line, e.Err)
+}
+
+type UnknownProfileError struct {
+	Profile string
+}
+
+func (e UnknownProfileError) Error() string {
+	return fmt.Sprintf("options: profile \"%s\" is not in any configuration file", e.Profile)
+}
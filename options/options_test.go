@@ -0,0 +1,128 @@
+package options
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testConfig = `
+# Shared settings.
+backend = consul
+address = http://127.0.0.1:8500
+
+[staging]
+address = "http://consul.staging:8500"
+key_path = /etc/context/staging.key
+`
+
+func TestParseConfig(t *testing.T) {
+	config, err := ParseConfig(strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &Config{
+		Settings: map[string]string{Backend: "consul", Address: "http://127.0.0.1:8500"},
+		Profiles: map[string]map[string]string{
+			"staging": {Address: "http://consul.staging:8500", KeyPath: "/etc/context/staging.key"},
+		},
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("expected %v but found %v!", expected, config)
+	}
+
+	for _, bad := range []string{
+		"unknown = 1",
+		"backend",
+		"[staging",
+		"[]",
+	} {
+		if _, err := ParseConfig(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected an error parsing %q!", bad)
+		} else if _, ok := err.(ConfigError); !ok {
+			t.Errorf("expected a ConfigError but found %v!", err)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	system := &Config{
+		Settings: map[string]string{Backend: "consul", Namespace: "system"},
+		Profiles: map[string]map[string]string{"staging": {Address: "system-staging", Group: "system-staging"}},
+	}
+	user := &Config{
+		Settings: map[string]string{Namespace: "user", Group: "user"},
+		Profiles: map[string]map[string]string{"staging": {Address: "user-staging"}},
+	}
+
+	env := map[string]string{"CONTEXT_CRYPTER": "gcm"}
+	lookupEnv := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	settings, err := resolve([]*Config{system, user}, "", lookupEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		Address:   DefaultAddress,
+		Namespace: "user",
+		Protocol:  DefaultProtocol,
+		Backend:   "consul",
+		Crypter:   "gcm",
+		KeyPath:   DefaultKeyPath,
+		Group:     "user",
+	}
+	if !reflect.DeepEqual(settings, expected) {
+		t.Errorf("expected %v but found %v!", expected, settings)
+	}
+
+	// A profile overrides the settings outside it in either file, and may be
+	// selected from the environment.
+	env[ProfileEnv] = "staging"
+	if settings, err = resolve([]*Config{system, user}, "", lookupEnv); err != nil {
+		t.Fatal(err)
+	}
+
+	expected[Address] = "user-staging"
+	expected[Group] = "system-staging"
+	if !reflect.DeepEqual(settings, expected) {
+		t.Errorf("expected %v but found %v!", expected, settings)
+	}
+
+	if _, err := resolve([]*Config{system, user}, "production", lookupEnv); err == nil {
+		t.Error("expected an error for an unknown profile!")
+	}
+}
+
+func TestReadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "context-options")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if config, err := ReadConfig(filepath.Join(dir, "missing")); err != nil || len(config.Settings) != 0 {
+		t.Errorf("expected a missing file to be empty but found %v, %v!", config, err)
+	}
+
+	configPath := filepath.Join(dir, "config")
+	if err := ioutil.WriteFile(configPath, []byte("backend = redis\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := ReadConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Settings[Backend] != "redis" {
+		t.Errorf("expected the redis backend but found %v!", config.Settings)
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/garyburd/redigo/redis"
+	"github.com/newsdev/context/backend"
+	"github.com/newsdev/context/crypter"
+	"github.com/newsdev/context/envfile"
+)
+
+// An APIError is an error as reported to clients, with the HTTP status it is
+// sent with and a code that programs can rely on. It is sent as
+//
+//	{"error": {"code": "not_found", "message": "..."}}
+type APIError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e APIError) Error() string {
+	return fmt.Sprintf("server: %s", e.Message)
+}
+
+func (e APIError) write(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Status)
+	json.NewEncoder(w).Encode(struct {
+		Error APIError `json:"error"`
+	}{e})
+}
+
+// apiError maps an error from a backend, a crypter or envfile onto the
+// status and code that best describe it. Errors that are the server's own
+// problem get a fixed message, since their details may describe the backend
+// or the values stored in it, and are only logged.
+func apiError(err error) APIError {
+	switch err := err.(type) {
+	case APIError:
+		return err
+	case backend.NoBackendError, crypter.NoCrypterError:
+		return APIError{http.StatusNotImplemented, "not_implemented", "the configured backend or crypter is not implemented"}
+	case crypter.KeyMismatchError, crypter.EnvelopeError:
+		return APIError{http.StatusInternalServerError, "undecryptable", "a stored value could not be decrypted"}
+	case envfile.UnknownFormatError, envfile.ValueError:
+		return APIError{http.StatusBadRequest, "bad_format", err.Error()}
+	}
+
+	if backend.IsNotFound(err) {
+		return APIError{http.StatusNotFound, "not_found", err.Error()}
+	}
+
+	// Anything else the backend service itself reported is its problem, not
+	// the client's.
+	switch err.(type) {
+	case backend.ConsulError, *etcd.EtcdError, redis.Error:
+		return APIError{http.StatusBadGateway, "backend_error", "the backend failed"}
+	}
+
+	return APIError{http.StatusInternalServerError, "internal_error", "an internal error occurred"}
+}
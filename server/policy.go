@@ -0,0 +1,141 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+const (
+	ReadAccess  = "read"
+	WriteAccess = "write"
+)
+
+// A Policy names the tokens that clients may present and decides what each
+// identity may do. Clients are identified by the name of their token, or by
+// the common name of their verified client certificate.
+type Policy struct {
+	Tokens []Token `json:"tokens"`
+	Rules  []Rule  `json:"rules"`
+}
+
+type Token struct {
+	Identity string `json:"identity"`
+	Token    string `json:"token"`
+}
+
+// A Rule grants access to the groups matching any of its patterns to the
+// identities matching any of its patterns. Patterns are as understood by
+// path.Match, and access is read, write or both.
+type Rule struct {
+	Identities []string `json:"identities"`
+	Groups     []string `json:"groups"`
+	Access     []string `json:"access"`
+}
+
+// ReadPolicy reads a policy from a JSON file which, as it holds tokens, must
+// only be readable by its owner.
+func ReadPolicy(policyPath string) (*Policy, error) {
+	stat, err := os.Stat(policyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode := stat.Mode(); mode != 0600 && mode != 0400 {
+		return nil, PolicyError{"incorrect file mode for policy"}
+	}
+
+	data, err := ioutil.ReadFile(policyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &Policy{}
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, PolicyError{err.Error()}
+	}
+
+	if err := policy.Check(); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// Check reports the first mistake in the policy, if any.
+func (p *Policy) Check() error {
+	for _, token := range p.Tokens {
+		if token.Identity == "" || token.Token == "" {
+			return PolicyError{"tokens need both an identity and a token"}
+		}
+	}
+
+	for _, rule := range p.Rules {
+		for _, pattern := range append(append([]string{}, rule.Identities...), rule.Groups...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return PolicyError{fmt.Sprintf("bad pattern \"%s\"", pattern)}
+			}
+		}
+
+		for _, access := range rule.Access {
+			if access != ReadAccess && access != WriteAccess {
+				return PolicyError{fmt.Sprintf("unknown access \"%s\"", access)}
+			}
+		}
+	}
+
+	return nil
+}
+
+// identify returns the identity a token belongs to. Every token is compared
+// in constant time, so that timing says nothing about which ones exist.
+func (p *Policy) identify(token string) (string, bool) {
+	var identity string
+	for _, t := range p.Tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t.Token)) == 1 {
+			identity = t.Identity
+		}
+	}
+
+	return identity, identity != ""
+}
+
+// Allow reports whether any rule grants identity the access to group.
+func (p *Policy) Allow(identity, group, access string) bool {
+	for _, rule := range p.Rules {
+		if matchAny(rule.Identities, identity) && matchAny(rule.Groups, group) && contains(rule.Access, access) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type PolicyError struct {
+	Err string
+}
+
+func (e PolicyError) Error() string {
+	return fmt.Sprintf("server: policy: %s", e.Err)
+}
@@ -0,0 +1,345 @@
+// Package server exposes groups and variables as a JSON HTTP API, so that
+// programs in other languages can manage them without running the command.
+//
+// Every request must identify its client, either with a verified TLS client
+// certificate or with a bearer token, and the policy decides which groups
+// each client may read and write. The API is:
+//
+//	GET    /v1/groups                            list the readable groups
+//	GET    /v1/groups/{group}                    list a group's variables
+//	DELETE /v1/groups/{group}                    remove a group
+//	GET    /v1/groups/{group}/export?format=     export a group's values
+//	GET    /v1/groups/{group}/variables/{name}   get a value
+//	PUT    /v1/groups/{group}/variables/{name}   set a value
+//	DELETE /v1/groups/{group}/variables/{name}   remove a value
+//
+// Values are sent as {"value": "..."}, or as {"value_base64": "..."} when
+// they aren't valid text. Setting a value answers with {"status": "added"},
+// "updated" or "unchanged", never with the value itself.
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/newsdev/context/backend"
+	"github.com/newsdev/context/crypter"
+	"github.com/newsdev/context/envfile"
+)
+
+const (
+	PathPrefix = "/v1/groups"
+
+	// MaxBodySize limits the body of a request that sets a value.
+	MaxBodySize = 1 << 20
+)
+
+// A Handler serves the API from a backend, encrypting and decrypting values
+// with a crypter.
+type Handler struct {
+	Backend backend.Backend
+	Crypter crypter.Crypter
+	Policy  *Policy
+}
+
+func NewHandler(b backend.Backend, c crypter.Crypter, policy *Policy) *Handler {
+	return &Handler{
+		Backend: b,
+		Crypter: c,
+		Policy:  policy,
+	}
+}
+
+type Value struct {
+	Value       *string `json:"value,omitempty"`
+	ValueBase64 *string `json:"value_base64,omitempty"`
+}
+
+func newValue(value []byte) Value {
+	s := string(value)
+	if utf8.Valid(value) {
+		return Value{Value: &s}
+	}
+
+	s = base64.StdEncoding.EncodeToString(value)
+	return Value{ValueBase64: &s}
+}
+
+func (v Value) bytes() ([]byte, error) {
+	switch {
+	case v.Value != nil && v.ValueBase64 != nil:
+		return nil, APIError{http.StatusBadRequest, "bad_request", "only one of value and value_base64 may be given"}
+	case v.Value != nil:
+		return []byte(*v.Value), nil
+	case v.ValueBase64 != nil:
+		value, err := base64.StdEncoding.DecodeString(*v.ValueBase64)
+		if err != nil {
+			return nil, APIError{http.StatusBadRequest, "bad_request", "value_base64 is not valid base64"}
+		}
+		return value, nil
+	}
+
+	return nil, APIError{http.StatusBadRequest, "bad_request", "a value must be given"}
+}
+
+// identity returns who the client is. A verified certificate is preferred
+// to a token.
+func (h *Handler) identity(r *http.Request) (string, error) {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		if name := r.TLS.VerifiedChains[0][0].Subject.CommonName; name != "" {
+			return name, nil
+		}
+	}
+
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		if identity, ok := h.Policy.identify(strings.TrimPrefix(auth, "Bearer ")); ok {
+			return identity, nil
+		}
+	}
+
+	return "", APIError{http.StatusUnauthorized, "unauthorized", "a valid client certificate or token is required"}
+}
+
+func (h *Handler) authorize(identity, group, access string) error {
+	if !h.Policy.Allow(identity, group, access) {
+		return APIError{http.StatusForbidden, "forbidden", fmt.Sprintf("%s access to group \"%s\" is not allowed", access, group)}
+	}
+	return nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h.serve(w, r); err != nil {
+		e := apiError(err)
+		if e.Status >= http.StatusInternalServerError {
+			log.Printf("server: %s %s: %s", r.Method, r.URL.Path, err)
+		}
+		e.write(w)
+	}
+}
+
+func (h *Handler) serve(w http.ResponseWriter, r *http.Request) error {
+	identity, err := h.identity(r)
+	if err != nil {
+		return err
+	}
+
+	// Split the path into the group and what is asked of it.
+	if r.URL.Path != PathPrefix && !strings.HasPrefix(r.URL.Path, PathPrefix+"/") {
+		return APIError{http.StatusNotFound, "not_found", fmt.Sprintf("no such endpoint %s", r.URL.Path)}
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, PathPrefix), "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "":
+		return h.groups(w, r, identity)
+	case len(parts) == 1:
+		return h.group(w, r, identity, parts[0])
+	case len(parts) == 2 && parts[1] == "export":
+		return h.export(w, r, identity, parts[0])
+	case len(parts) == 3 && parts[1] == "variables" && parts[2] != "":
+		return h.variable(w, r, identity, parts[0], parts[2])
+	}
+
+	return APIError{http.StatusNotFound, "not_found", fmt.Sprintf("no such endpoint %s", r.URL.Path)}
+}
+
+func methodNotAllowed(w http.ResponseWriter, methods ...string) error {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	return APIError{http.StatusMethodNotAllowed, "method_not_allowed", fmt.Sprintf("only %s are allowed", strings.Join(methods, ", "))}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(v)
+}
+
+// groups lists the groups the client may read.
+func (h *Handler) groups(w http.ResponseWriter, r *http.Request, identity string) error {
+	if r.Method != "GET" {
+		return methodNotAllowed(w, "GET")
+	}
+
+	groups, err := h.Backend.ListGroups()
+	if err != nil {
+		return err
+	}
+
+	readable := make([]string, 0, len(groups))
+	for _, group := range groups {
+		if h.Policy.Allow(identity, group, ReadAccess) {
+			readable = append(readable, group)
+		}
+	}
+
+	return writeJSON(w, http.StatusOK, map[string][]string{"groups": readable})
+}
+
+func (h *Handler) group(w http.ResponseWriter, r *http.Request, identity, group string) error {
+	switch r.Method {
+	case "GET":
+		if err := h.authorize(identity, group, ReadAccess); err != nil {
+			return err
+		}
+
+		encryptedEnv, err := h.Backend.GetGroup(group)
+		if err != nil {
+			return err
+		}
+
+		variables := make([]string, 0, len(encryptedEnv))
+		for variable := range encryptedEnv {
+			variables = append(variables, variable)
+		}
+		sort.Strings(variables)
+
+		return writeJSON(w, http.StatusOK, map[string][]string{"variables": variables})
+	case "DELETE":
+		if err := h.authorize(identity, group, WriteAccess); err != nil {
+			return err
+		}
+
+		if err := h.Backend.RemoveGroup(group); err != nil && !backend.IsNotFound(err) {
+			return err
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	return methodNotAllowed(w, "GET", "DELETE")
+}
+
+// export writes a group's values in one of the envfile formats, JSON by
+// default.
+func (h *Handler) export(w http.ResponseWriter, r *http.Request, identity, group string) error {
+	if r.Method != "GET" {
+		return methodNotAllowed(w, "GET")
+	}
+
+	if err := h.authorize(identity, group, ReadAccess); err != nil {
+		return err
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+
+	env, err := h.decryptGroup(group)
+	if err != nil {
+		return err
+	}
+
+	// Format everything before writing anything, so that an error is still
+	// reported with the right status.
+	var buf bytes.Buffer
+	if err := envfile.Write(&buf, format, env); err != nil {
+		return err
+	}
+
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+func (h *Handler) decryptGroup(group string) (map[string]string, error) {
+	encryptedEnv, err := h.Backend.GetGroup(group)
+	if err != nil {
+		return nil, err
+	}
+
+	env := make(map[string]string, len(encryptedEnv))
+	for variable, encryptedValue := range encryptedEnv {
+		value, err := crypter.ValidateAndDecryptWithData(h.Crypter, encryptedValue, crypter.AssociatedData(h.Backend.Namespace(), group, variable))
+		if err != nil {
+			return nil, err
+		}
+		env[variable] = string(value)
+	}
+
+	return env, nil
+}
+
+func (h *Handler) variable(w http.ResponseWriter, r *http.Request, identity, group, variable string) error {
+	data := crypter.AssociatedData(h.Backend.Namespace(), group, variable)
+
+	switch r.Method {
+	case "GET":
+		if err := h.authorize(identity, group, ReadAccess); err != nil {
+			return err
+		}
+
+		encryptedValue, err := h.Backend.GetVariable(group, variable)
+		if err != nil {
+			return err
+		}
+
+		value, err := crypter.ValidateAndDecryptWithData(h.Crypter, encryptedValue, data)
+		if err != nil {
+			return err
+		}
+
+		return writeJSON(w, http.StatusOK, newValue(value))
+	case "PUT":
+		if err := h.authorize(identity, group, WriteAccess); err != nil {
+			return err
+		}
+
+		var v Value
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxBodySize)).Decode(&v); err != nil {
+			return APIError{http.StatusBadRequest, "bad_request", err.Error()}
+		}
+
+		value, err := v.bytes()
+		if err != nil {
+			return err
+		}
+
+		// Report whether the variable changed, as set does.
+		status, result := http.StatusCreated, "added"
+		if encryptedValue, err := h.Backend.GetVariable(group, variable); err == nil {
+			if current, err := crypter.ValidateAndDecryptWithData(h.Crypter, encryptedValue, data); err == nil && bytes.Equal(current, value) && crypter.Current(h.Crypter, encryptedValue) {
+				return writeJSON(w, http.StatusOK, map[string]string{"status": "unchanged"})
+			}
+			status, result = http.StatusOK, "updated"
+		} else if !backend.IsNotFound(err) {
+			return err
+		}
+
+		encryptedValue, err := crypter.EncryptAndSignWithData(h.Crypter, value, data)
+		if err != nil {
+			return err
+		}
+
+		if err := h.Backend.SetVariable(group, variable, encryptedValue); err != nil {
+			return err
+		}
+
+		return writeJSON(w, status, map[string]string{"status": result})
+	case "DELETE":
+		if err := h.authorize(identity, group, WriteAccess); err != nil {
+			return err
+		}
+
+		if err := h.Backend.RemoveVariable(group, variable); err != nil && !backend.IsNotFound(err) {
+			return err
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	return methodNotAllowed(w, "GET", "PUT", "DELETE")
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/garyburd/redigo/redis"
+	"github.com/newsdev/context/backend"
+	"github.com/newsdev/context/crypter"
+)
+
+var testPolicy = &Policy{
+	Tokens: []Token{
+		{"deploy", "deploy-token"},
+		{"reader", "reader-token"},
+	},
+	Rules: []Rule{
+		{Identities: []string{"deploy"}, Groups: []string{"app-*"}, Access: []string{ReadAccess, WriteAccess}},
+		{Identities: []string{"reader", "ci"}, Groups: []string{"app-production"}, Access: []string{ReadAccess}},
+	},
+}
+
+func newTestHandler(t *testing.T) *Handler {
+	key, err := crypter.NewKey("gcm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := crypter.NewEnvelopeCrypter("gcm", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewHandler(backend.NewMemoryBackend("servertest"), c, testPolicy)
+}
+
+// do sends a request with a token, returning the status and decoding any
+// JSON body into v.
+func do(t *testing.T, h http.Handler, method, path, token, body string, v interface{}) int {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if v != nil && w.Body.Len() > 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: %s", method, path, err)
+		}
+	}
+
+	return w.Code
+}
+
+type errorBody struct {
+	Error APIError `json:"error"`
+}
+
+func TestVariables(t *testing.T) {
+	h := newTestHandler(t)
+	path := "/v1/groups/app-production/variables/A"
+
+	var result map[string]string
+	for _, expected := range []struct {
+		body, status string
+		code         int
+	}{
+		{`{"value": "1"}`, "added", http.StatusCreated},
+		{`{"value": "1"}`, "unchanged", http.StatusOK},
+		{`{"value": "2"}`, "updated", http.StatusOK},
+	} {
+		if code := do(t, h, "PUT", path, "deploy-token", expected.body, &result); code != expected.code || result["status"] != expected.status {
+			t.Errorf("expected %d %s but found %d %s!", expected.code, expected.status, code, result["status"])
+		}
+	}
+
+	var value Value
+	if code := do(t, h, "GET", path, "reader-token", "", &value); code != http.StatusOK {
+		t.Fatalf("expected status 200 but found %d!", code)
+	}
+	if value.Value == nil || *value.Value != "2" {
+		t.Errorf("expected the value 2 but found %v!", value)
+	}
+
+	// Values that aren't text are sent as base64.
+	if code := do(t, h, "PUT", "/v1/groups/app-production/variables/B", "deploy-token", `{"value_base64": "AP8="}`, nil); code != http.StatusCreated {
+		t.Errorf("expected status 201 but found %d!", code)
+	}
+	value = Value{}
+	do(t, h, "GET", "/v1/groups/app-production/variables/B", "reader-token", "", &value)
+	if value.ValueBase64 == nil || *value.ValueBase64 != "AP8=" {
+		t.Errorf("expected a base64 value but found %v!", value)
+	}
+
+	var variables map[string][]string
+	do(t, h, "GET", "/v1/groups/app-production", "reader-token", "", &variables)
+	if expected := []string{"A", "B"}; !reflect.DeepEqual(variables["variables"], expected) {
+		t.Errorf("expected %v but found %v!", expected, variables["variables"])
+	}
+
+	if code := do(t, h, "DELETE", path, "deploy-token", "", nil); code != http.StatusNoContent {
+		t.Errorf("expected status 204 but found %d!", code)
+	}
+
+	var e errorBody
+	if code := do(t, h, "GET", path, "reader-token", "", &e); code != http.StatusNotFound || e.Error.Code != "not_found" {
+		t.Errorf("expected not_found but found %d %v!", code, e.Error)
+	}
+}
+
+func TestGroups(t *testing.T) {
+	h := newTestHandler(t)
+	for _, group := range []string{"app-production", "app-staging"} {
+		if code := do(t, h, "PUT", "/v1/groups/"+group+"/variables/A", "deploy-token", `{"value": "x y"}`, nil); code != http.StatusCreated {
+			t.Fatalf("expected status 201 but found %d!", code)
+		}
+	}
+
+	// Only the groups that can be read are listed.
+	var groups map[string][]string
+	do(t, h, "GET", "/v1/groups", "reader-token", "", &groups)
+	if expected := []string{"app-production"}; !reflect.DeepEqual(groups["groups"], expected) {
+		t.Errorf("expected %v but found %v!", expected, groups["groups"])
+	}
+
+	r := httptest.NewRequest("GET", "/v1/groups/app-production/export?format=dotenv", nil)
+	r.Header.Set("Authorization", "Bearer reader-token")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if expected := "A='x y'\n"; w.Code != http.StatusOK || w.Body.String() != expected {
+		t.Errorf("expected %q but found %d %q!", expected, w.Code, w.Body.String())
+	}
+
+	var e errorBody
+	if code := do(t, h, "GET", "/v1/groups/app-production/export?format=xml", "reader-token", "", &e); code != http.StatusBadRequest || e.Error.Code != "bad_format" {
+		t.Errorf("expected bad_format but found %d %v!", code, e.Error)
+	}
+
+	if code := do(t, h, "DELETE", "/v1/groups/app-staging", "deploy-token", "", nil); code != http.StatusNoContent {
+		t.Errorf("expected status 204 but found %d!", code)
+	}
+
+	do(t, h, "GET", "/v1/groups", "deploy-token", "", &groups)
+	if expected := []string{"app-production"}; !reflect.DeepEqual(groups["groups"], expected) {
+		t.Errorf("expected %v but found %v!", expected, groups["groups"])
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	h := newTestHandler(t)
+	path := "/v1/groups/app-production/variables/A"
+
+	for _, test := range []struct {
+		method, path, token, body string
+		status                    int
+		code                      string
+	}{
+		{"GET", path, "", "", http.StatusUnauthorized, "unauthorized"},
+		{"GET", path, "wrong-token", "", http.StatusUnauthorized, "unauthorized"},
+		{"PUT", path, "reader-token", `{"value": "1"}`, http.StatusForbidden, "forbidden"},
+		{"GET", "/v1/groups/other/variables/A", "deploy-token", "", http.StatusForbidden, "forbidden"},
+		{"POST", path, "deploy-token", "", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"PUT", path, "deploy-token", `{}`, http.StatusBadRequest, "bad_request"},
+		{"PUT", path, "deploy-token", `{"value": "` + strings.Repeat("a", MaxBodySize) + `"}`, http.StatusBadRequest, "bad_request"},
+		{"GET", "/v2/groups", "deploy-token", "", http.StatusNotFound, "not_found"},
+	} {
+		var e errorBody
+		if status := do(t, h, test.method, test.path, test.token, test.body, &e); status != test.status || e.Error.Code != test.code {
+			t.Errorf("%s %s: expected %d %s but found %d %s!", test.method, test.path, test.status, test.code, status, e.Error.Code)
+		}
+	}
+
+	// A verified client certificate identifies the client by its common name.
+	r := httptest.NewRequest("GET", "/v1/groups", nil)
+	r.TLS = &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "ci"}}}},
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected a client certificate to be accepted but found %d!", w.Code)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	for _, test := range []struct {
+		err    error
+		status int
+	}{
+		{backend.NoVariableError{Group: "group", Variable: "A"}, http.StatusNotFound},
+		{&etcd.EtcdError{ErrorCode: 100}, http.StatusNotFound},
+		{&etcd.EtcdError{ErrorCode: 501}, http.StatusBadGateway},
+		{redis.ErrNil, http.StatusNotFound},
+		{redis.Error("ERR"), http.StatusBadGateway},
+		{backend.ConsulError{StatusCode: http.StatusNotFound}, http.StatusNotFound},
+		{backend.ConsulError{StatusCode: http.StatusForbidden}, http.StatusBadGateway},
+		{backend.NoBackendError{Kind: "kind"}, http.StatusNotImplemented},
+		{crypter.NoCrypterError{Kind: "kind"}, http.StatusNotImplemented},
+		{os.ErrPermission, http.StatusInternalServerError},
+	} {
+		if status := apiError(test.err).Status; status != test.status {
+			t.Errorf("%v: expected status %d but found %d!", test.err, test.status, status)
+		}
+	}
+
+	// The details of the server's own errors aren't sent to clients.
+	err := &os.PathError{Op: "open", Path: "/etc/context/key", Err: os.ErrPermission}
+	if e := apiError(err); strings.Contains(e.Message, err.Path) {
+		t.Errorf("expected the message to leave out the error's details but found %q!", e.Message)
+	}
+}
+
+func TestReadPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "context-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	policyPath := filepath.Join(dir, "server.json")
+	data, err := json.Marshal(testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(policyPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadPolicy(policyPath); err == nil {
+		t.Error("expected a policy readable by others to be refused!")
+	}
+
+	if err := os.Chmod(policyPath, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := ReadPolicy(policyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(policy, testPolicy) {
+		t.Errorf("expected %v but found %v!", testPolicy, policy)
+	}
+
+	for _, bad := range []*Policy{
+		{Tokens: []Token{{"deploy", ""}}},
+		{Rules: []Rule{{Groups: []string{"["}}}},
+		{Rules: []Rule{{Access: []string{"admin"}}}},
+	} {
+		if err := bad.Check(); err == nil {
+			t.Errorf("expected an error for %v!", bad)
+		}
+	}
+}
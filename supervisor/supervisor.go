@@ -0,0 +1,262 @@
+// Package supervisor runs a command as a child process, standing in for it
+// the way exec would: signals are passed on, the exit status is passed back,
+// and cleanup runs once the child is gone.
+package supervisor
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// forwardedSignals are passed on to the command. Any other signal has its
+// usual effect on the supervisor.
+var forwardedSignals = []os.Signal{
+	syscall.SIGHUP,
+	syscall.SIGINT,
+	syscall.SIGQUIT,
+	syscall.SIGTERM,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+	syscall.SIGWINCH,
+	syscall.SIGTSTP,
+	syscall.SIGCONT,
+}
+
+// terminalSignals are sent by the kernel to every process in the foreground
+// process group, so a child sharing our terminal has already received them
+// when they come from the terminal.
+var terminalSignals = map[os.Signal]bool{
+	syscall.SIGINT:   true,
+	syscall.SIGQUIT:  true,
+	syscall.SIGTSTP:  true,
+	syscall.SIGWINCH: true,
+}
+
+// DefaultStopTimeout is how long a command being restarted is given to exit
+// after StopSignal before it is killed.
+const DefaultStopTimeout = 10 * time.Second
+
+// A Supervisor runs a command to completion, restarting it on request.
+type Supervisor struct {
+	Cmd *exec.Cmd
+
+	// Reap makes the supervisor wait for every child that exits, not only
+	// the command, as an init process must. It defaults to true when running
+	// as PID 1, such as in a container.
+	Reap bool
+
+	// Terminal reports whether the command shares our controlling terminal,
+	// in which case terminal signals are not sent to it a second time while
+	// we are in the terminal's foreground process group. It defaults to
+	// whether standard input is a terminal.
+	Terminal bool
+
+	// StopSignal asks the command to exit before a restart, and StopTimeout
+	// is how long it has to do so before it is killed.
+	StopSignal  os.Signal
+	StopTimeout time.Duration
+
+	cleanups []func()
+	requests chan request
+	done     chan struct{}
+}
+
+// A request asks Run to signal the command, or to replace it with next.
+type request struct {
+	signal os.Signal
+	next   *exec.Cmd
+}
+
+// New returns a supervisor for cmd, which must not have been started. The
+// command is waited for directly rather than with Cmd.Wait, so its standard
+// streams should be files, such as os.Stdin, rather than other readers and
+// writers.
+func New(cmd *exec.Cmd) *Supervisor {
+	return &Supervisor{
+		Cmd:         cmd,
+		Reap:        os.Getpid() == 1,
+		Terminal:    isTerminal(os.Stdin),
+		StopSignal:  syscall.SIGTERM,
+		StopTimeout: DefaultStopTimeout,
+		requests:    make(chan request),
+		done:        make(chan struct{}),
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// isForeground reports whether our process group is the foreground process
+// group of the terminal f, and so receives the signals typed at it.
+func isForeground(f *os.File) bool {
+	var pgrp int32
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), syscall.TIOCGPGRP, uintptr(unsafe.Pointer(&pgrp)))
+	return errno == 0 && int(pgrp) == syscall.Getpgrp()
+}
+
+// OnExit adds a function to run once the command has exited, or failed to
+// start. Functions run in the reverse of the order they were added.
+func (s *Supervisor) OnExit(f func()) {
+	s.cleanups = append(s.cleanups, f)
+}
+
+func (s *Supervisor) cleanup() {
+	for i := len(s.cleanups) - 1; i >= 0; i-- {
+		s.cleanups[i]()
+	}
+}
+
+// Signal sends sig to the running command. It may be called from any
+// goroutine, and does nothing once Run has returned.
+func (s *Supervisor) Signal(sig os.Signal) {
+	select {
+	case s.requests <- request{signal: sig}:
+	case <-s.done:
+	}
+}
+
+// Restart stops the running command with StopSignal and starts next in its
+// place, without running the OnExit functions in between. If a restart is
+// already under way, next replaces the command it was going to start. It
+// may be called from any goroutine, and does nothing once Run has returned.
+func (s *Supervisor) Restart(next *exec.Cmd) {
+	select {
+	case s.requests <- request{next: next}:
+	case <-s.done:
+	}
+}
+
+// Run starts the command and waits for it to exit, forwarding the signals
+// received in the meantime. It returns the status to exit with: the
+// command's own exit status, or 128 plus the signal number if it was killed
+// by a signal, as a shell would report it.
+func (s *Supervisor) Run() (int, error) {
+	defer s.cleanup()
+	defer close(s.done)
+
+	// Start listening before the command starts so that no signal is missed.
+	signals := make(chan os.Signal, 32)
+	signal.Notify(signals, forwardedSignals...)
+	if s.Reap {
+		signal.Notify(signals, syscall.SIGCHLD)
+	}
+	defer signal.Stop(signals)
+
+	exited := make(chan syscall.WaitStatus, 1)
+	if err := s.start(s.Cmd, exited); err != nil {
+		return 1, err
+	}
+
+	var next *exec.Cmd
+	var kill <-chan time.Time
+	for {
+		select {
+		case status := <-exited:
+			if next == nil {
+				return exitStatus(status), nil
+			}
+
+			s.Cmd, next, kill = next, nil, nil
+			if err := s.start(s.Cmd, exited); err != nil {
+				return 1, err
+			}
+		case r := <-s.requests:
+			if r.next == nil {
+				s.Cmd.Process.Signal(r.signal)
+				continue
+			}
+
+			if next == nil {
+				s.Cmd.Process.Signal(s.StopSignal)
+				kill = time.After(s.StopTimeout)
+			}
+			next = r.next
+		case <-kill:
+			s.Cmd.Process.Kill()
+		case sig := <-signals:
+			if sig == syscall.SIGCHLD {
+				if status, ok := s.reap(s.Cmd.Process.Pid); ok {
+					exited <- status
+				}
+				continue
+			}
+
+			// A signal sent to this process alone, rather than typed at the
+			// terminal, still has to reach the command.
+			if !(s.Terminal && terminalSignals[sig] && isForeground(os.Stdin)) {
+				s.Cmd.Process.Signal(sig)
+			}
+
+			if sig == syscall.SIGTSTP {
+				s.suspend()
+			}
+		}
+	}
+}
+
+// suspend stops this process as SIGTSTP would have had it not been caught,
+// once the command has been stopped. The Go runtime keeps its own handler
+// for SIGTSTP even after signal.Reset, so the stop has to come from SIGSTOP,
+// which can't be caught.
+func (s *Supervisor) suspend() {
+	syscall.Kill(os.Getpid(), syscall.SIGSTOP)
+}
+
+// start starts cmd, arranging for its status to be sent on exited. Without
+// reaping, a goroutine waits for the command. Otherwise every exited child is
+// collected as SIGCHLD arrives.
+func (s *Supervisor) start(cmd *exec.Cmd, exited chan<- syscall.WaitStatus) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	if !s.Reap {
+		pid := cmd.Process.Pid
+		go func() {
+			var status syscall.WaitStatus
+			for {
+				_, err := syscall.Wait4(pid, &status, 0, nil)
+				if err != syscall.EINTR {
+					break
+				}
+			}
+			exited <- status
+		}()
+	}
+
+	return nil
+}
+
+// reap collects every child that has exited, reporting the command's status
+// if it was among them.
+func (s *Supervisor) reap(pid int) (syscall.WaitStatus, bool) {
+	var commandStatus syscall.WaitStatus
+	var commandExited bool
+	for {
+		var status syscall.WaitStatus
+		reaped, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil || reaped <= 0 {
+			return commandStatus, commandExited
+		}
+
+		if reaped == pid {
+			commandStatus, commandExited = status, true
+		}
+	}
+}
+
+func exitStatus(status syscall.WaitStatus) int {
+	if status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return status.ExitStatus()
+}
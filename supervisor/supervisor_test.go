@@ -0,0 +1,291 @@
+package supervisor
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestExitStatus(t *testing.T) {
+	for script, expected := range map[string]int{
+		"exit 0":        0,
+		"exit 7":        7,
+		"kill -TERM $$": 128 + int(syscall.SIGTERM),
+	} {
+		status, err := New(exec.Command("sh", "-c", script)).Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if status != expected {
+			t.Errorf("%s: expected exit status %d but found %d!", script, expected, status)
+		}
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	var order []int
+	s := New(exec.Command("true"))
+	s.OnExit(func() { order = append(order, 1) })
+	s.OnExit(func() { order = append(order, 2) })
+
+	if _, err := s.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []int{2, 1}; !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected cleanup in order %v but found %v!", expected, order)
+	}
+
+	// Cleanup also runs when the command can't be started.
+	cleaned := false
+	s = New(exec.Command("/nonexistent/context-test"))
+	s.OnExit(func() { cleaned = true })
+	if _, err := s.Run(); err == nil {
+		t.Error("expected an error starting a missing command!")
+	}
+	if !cleaned {
+		t.Error("expected cleanup to run!")
+	}
+}
+
+func TestForwardSignals(t *testing.T) {
+	dir, err := ioutil.TempDir("", "context-supervisor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The command signals that it's ready by creating a file, then exits with
+	// a status that shows which signal it received.
+	ready := filepath.Join(dir, "ready")
+	s := New(exec.Command("sh", "-c", `trap 'exit 10' USR1; trap 'exit 20' TERM; touch "$1"; while :; do sleep 0.01; done`, "sh", ready))
+	s.Terminal = false
+
+	go waitFor(ready, func() { syscall.Kill(os.Getpid(), syscall.SIGUSR1) })
+
+	status, err := s.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != 10 {
+		t.Errorf("expected exit status 10 but found %d!", status)
+	}
+}
+
+func TestForwardTerminalSignals(t *testing.T) {
+	dir, err := ioutil.TempDir("", "context-supervisor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Outside the terminal's foreground process group, a terminal signal
+	// was sent to this process alone, so it must still be forwarded.
+	stdin := os.Stdin
+	defer func() { os.Stdin = stdin }()
+	if os.Stdin, err = os.Open(os.DevNull); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Stdin.Close()
+
+	ready := filepath.Join(dir, "ready")
+	s := New(exec.Command("sh", "-c", `trap 'exit 12' INT; touch "$1"; while :; do sleep 0.01; done`, "sh", ready))
+	s.Terminal = true
+
+	go waitFor(ready, func() { syscall.Kill(os.Getpid(), syscall.SIGINT) })
+
+	status, err := s.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != 12 {
+		t.Errorf("expected exit status 12 but found %d!", status)
+	}
+}
+
+// TestSuspendHelper runs a supervisor for TestSuspend in a process of its
+// own, since suspending it stops the whole process.
+func TestSuspendHelper(t *testing.T) {
+	ready := os.Getenv("CONTEXT_TEST_SUSPEND")
+	if ready == "" {
+		return
+	}
+
+	status, _ := New(exec.Command("sh", "-c", `echo $$ > "$1.tmp"; mv "$1.tmp" "$1"; while :; do sleep 0.01; done`, "sh", ready)).Run()
+	os.Exit(status)
+}
+
+// processState returns the state of the process pid, such as "T" when it is
+// stopped.
+func processState(pid int) string {
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return ""
+	}
+
+	// The state follows the command name, which is in parentheses.
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// waitForStopped waits for the process pid to be stopped, or not, reporting
+// whether it was.
+func waitForStopped(pid int, stopped bool) bool {
+	for i := 0; i < 500; i++ {
+		if (processState(pid) == "T") == stopped {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestSuspend(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("no /proc to read process states from")
+	}
+
+	dir, err := ioutil.TempDir("", "context-supervisor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The helper gets a process group of its own, which stays stoppable
+	// because its parent is outside it.
+	ready := filepath.Join(dir, "ready")
+	helper := exec.Command(os.Args[0], "-test.run=^TestSuspendHelper$")
+	helper.Env = append(os.Environ(), "CONTEXT_TEST_SUSPEND="+ready)
+	helper.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := helper.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer helper.Process.Kill()
+
+	var child int
+	waitFor(ready, func() {
+		data, _ := ioutil.ReadFile(ready)
+		child, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+	})
+	if child == 0 {
+		t.Fatal("expected the command to start!")
+	}
+
+	// SIGTSTP stops the command and then the supervisor itself.
+	helper.Process.Signal(syscall.SIGTSTP)
+	if !waitForStopped(child, true) {
+		t.Error("expected the command to be stopped!")
+	}
+	if !waitForStopped(helper.Process.Pid, true) {
+		t.Error("expected the supervisor to be stopped!")
+	}
+
+	// Once continued, the supervisor continues the command and forwards
+	// signals again.
+	helper.Process.Signal(syscall.SIGCONT)
+	if !waitForStopped(child, false) {
+		t.Error("expected the command to be continued!")
+	}
+
+	helper.Process.Signal(syscall.SIGTERM)
+	err = helper.Wait()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ProcessState.Sys().(syscall.WaitStatus).ExitStatus() != 128+int(syscall.SIGTERM) {
+		t.Errorf("expected exit status %d but found %v!", 128+int(syscall.SIGTERM), err)
+	}
+}
+
+func TestReap(t *testing.T) {
+	s := New(exec.Command("sh", "-c", "sleep 0.01 & exit 4"))
+	s.Reap = true
+
+	status, err := s.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != 4 {
+		t.Errorf("expected exit status 4 but found %d!", status)
+	}
+}
+
+// waitFor calls f once the file at path exists.
+func waitFor(path string, f func()) {
+	for i := 0; i < 500; i++ {
+		if _, err := os.Stat(path); err == nil {
+			f()
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSignal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "context-supervisor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ready := filepath.Join(dir, "ready")
+	s := New(exec.Command("sh", "-c", `trap 'exit 11' HUP; touch "$1"; while :; do sleep 0.01; done`, "sh", ready))
+	go waitFor(ready, func() { s.Signal(syscall.SIGHUP) })
+
+	status, err := s.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != 11 {
+		t.Errorf("expected exit status 11 but found %d!", status)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "context-supervisor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The first command ignores the stop signal, so it has to be killed.
+	ready := filepath.Join(dir, "ready")
+	s := New(exec.Command("sh", "-c", `trap '' TERM; touch "$1"; while :; do sleep 0.01; done`, "sh", ready))
+	s.StopTimeout = 100 * time.Millisecond
+
+	cleanups := 0
+	s.OnExit(func() { cleanups++ })
+
+	go waitFor(ready, func() { s.Restart(exec.Command("sh", "-c", "exit 6")) })
+
+	status, err := s.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != 6 {
+		t.Errorf("expected the restarted command's exit status 6 but found %d!", status)
+	}
+
+	if cleanups != 1 {
+		t.Errorf("expected cleanup to run once but it ran %d times!", cleanups)
+	}
+
+	// Requests made once Run has returned are ignored rather than blocking.
+	s.Signal(syscall.SIGHUP)
+	s.Restart(exec.Command("true"))
+}
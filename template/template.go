@@ -0,0 +1,310 @@
+// Package template implements the argument templates used by the exec
+// command.
+//
+// A template is split into words the way a POSIX shell would split it, with
+// single quotes, double quotes and backslash escapes. Each word may contain
+// the tokens {name} and {value}, which are replaced by a variable's name and
+// value, and {} as a shorter form of {name}. {file} is replaced by the path
+// of the file a variable was written to, if any. Tokens are not expanded
+// inside single quotes, and {{ and }} stand for literal braces.
+package template
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+type partKind int
+
+const (
+	literalPart partKind = iota
+	namePart
+	valuePart
+	filePart
+)
+
+type part struct {
+	kind partKind
+	text string
+}
+
+type word []part
+
+// A Template is a parsed argument template.
+type Template struct {
+	words []word
+}
+
+// Parse parses s into a template.
+func Parse(s string) (*Template, error) {
+	p := &parser{input: s}
+	words, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Template{words}, nil
+}
+
+// A Variable is what a template is expanded with.
+type Variable struct {
+	Name, Value, File string
+}
+
+// Expand returns the arguments the template produces for a single variable.
+// Values are inserted as is, since arguments are passed to the command
+// without a shell.
+func (t *Template) Expand(v Variable) []string {
+	args := make([]string, len(t.words))
+	for i, w := range t.words {
+		var buf bytes.Buffer
+		for _, p := range w {
+			switch p.kind {
+			case literalPart:
+				buf.WriteString(p.text)
+			case namePart:
+				buf.WriteString(v.Name)
+			case valuePart:
+				buf.WriteString(v.Value)
+			case filePart:
+				buf.WriteString(v.File)
+			}
+		}
+		args[i] = buf.String()
+	}
+
+	return args
+}
+
+// ExpandAll expands the template for every variable in env that the filter
+// accepts, in order of name. files maps the names of variables written to
+// files to their paths, and may be nil.
+func (t *Template) ExpandAll(env, files map[string]string, filter *Filter) []string {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		if filter.Match(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	args := make([]string, 0, len(names)*len(t.words))
+	for _, name := range names {
+		args = append(args, t.Expand(Variable{name, env[name], files[name]})...)
+	}
+
+	return args
+}
+
+// A Filter selects variables by name using shell patterns, as understood by
+// path.Match. A variable is accepted if it matches any include pattern (or
+// there are none) and no exclude pattern. A nil Filter accepts everything.
+type Filter struct {
+	Include, Exclude []string
+}
+
+// NewFilter returns a filter from comma-separated lists of include and
+// exclude patterns, checking that each pattern is valid.
+func NewFilter(include, exclude string) (*Filter, error) {
+	f := &Filter{splitPatterns(include), splitPatterns(exclude)}
+	for _, pattern := range append(f.Include, f.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, TemplateError{fmt.Sprintf("bad pattern \"%s\"", pattern)}
+		}
+	}
+
+	return f, nil
+}
+
+func splitPatterns(s string) []string {
+	var patterns []string
+	for _, pattern := range strings.Split(s, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// Match reports whether the filter accepts the variable name.
+func (f *Filter) Match(name string) bool {
+	if f == nil {
+		return true
+	}
+
+	for _, pattern := range f.Exclude {
+		if matched, _ := path.Match(pattern, name); matched {
+			return false
+		}
+	}
+
+	if len(f.Include) == 0 {
+		return true
+	}
+
+	for _, pattern := range f.Include {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+type parser struct {
+	input string
+	pos   int
+
+	words   []word
+	current word
+	literal bytes.Buffer
+	inWord  bool
+}
+
+func (p *parser) parse() ([]word, error) {
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			p.pos++
+			p.endWord()
+		case c == '\'':
+			p.inWord = true
+			end := strings.IndexByte(p.input[p.pos+1:], '\'')
+			if end < 0 {
+				return nil, TemplateError{"unterminated single quote"}
+			}
+			p.literal.WriteString(p.input[p.pos+1 : p.pos+1+end])
+			p.pos += end + 2
+		case c == '"':
+			p.inWord = true
+			if err := p.doubleQuoted(); err != nil {
+				return nil, err
+			}
+		case c == '\\':
+			p.inWord = true
+			p.pos++
+			if p.pos >= len(p.input) {
+				return nil, TemplateError{"trailing backslash"}
+			}
+
+			// As in a shell, an escaped newline joins two lines.
+			if p.input[p.pos] != '\n' {
+				p.literal.WriteByte(p.input[p.pos])
+			}
+			p.pos++
+		case c == '{' || c == '}':
+			p.inWord = true
+			if err := p.brace(); err != nil {
+				return nil, err
+			}
+		default:
+			p.inWord = true
+			p.literal.WriteByte(c)
+			p.pos++
+		}
+	}
+
+	p.endWord()
+	return p.words, nil
+}
+
+// doubleQuoted reads a double-quoted string, in which a backslash only
+// escapes another backslash or a double quote and tokens are still expanded.
+func (p *parser) doubleQuoted() error {
+	p.pos++
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			return nil
+		case c == '\\' && p.pos+1 < len(p.input) && (p.input[p.pos+1] == '\\' || p.input[p.pos+1] == '"'):
+			p.literal.WriteByte(p.input[p.pos+1])
+			p.pos += 2
+		case c == '{' || c == '}':
+			if err := p.brace(); err != nil {
+				return err
+			}
+		default:
+			p.literal.WriteByte(c)
+			p.pos++
+		}
+	}
+
+	return TemplateError{"unterminated double quote"}
+}
+
+// brace reads a token or an escaped brace.
+func (p *parser) brace() error {
+	rest := p.input[p.pos:]
+	switch {
+	case strings.HasPrefix(rest, "{{"):
+		p.literal.WriteByte('{')
+		p.pos += 2
+		return nil
+	case strings.HasPrefix(rest, "}}"):
+		p.literal.WriteByte('}')
+		p.pos += 2
+		return nil
+	case rest[0] == '}':
+		return TemplateError{"unmatched }, use }} for a literal brace"}
+	}
+
+	end := strings.IndexByte(rest, '}')
+	if end < 0 {
+		return TemplateError{"unterminated token, use {{ for a literal brace"}
+	}
+
+	var kind partKind
+	switch token := rest[1:end]; token {
+	case "", "name":
+		kind = namePart
+	case "value":
+		kind = valuePart
+	case "file":
+		kind = filePart
+	default:
+		return TemplateError{fmt.Sprintf("unknown token {%s}", token)}
+	}
+
+	p.flushLiteral()
+	p.current = append(p.current, part{kind: kind})
+	p.pos += end + 1
+	return nil
+}
+
+func (p *parser) flushLiteral() {
+	if p.literal.Len() > 0 {
+		p.current = append(p.current, part{kind: literalPart, text: p.literal.String()})
+		p.literal.Reset()
+	}
+}
+
+func (p *parser) endWord() {
+	if !p.inWord {
+		return
+	}
+
+	p.flushLiteral()
+
+	// Keep empty words such as '' so that they can be passed as arguments.
+	if len(p.current) == 0 {
+		p.current = word{{kind: literalPart}}
+	}
+
+	p.words = append(p.words, p.current)
+	p.current = nil
+	p.inWord = false
+}
+
+type TemplateError struct {
+	Err string
+}
+
+func (e TemplateError) Error() string {
+	return fmt.Sprintf("template: %s", e.Err)
+}
@@ -0,0 +1,77 @@
+package template
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	for _, test := range []struct {
+		template string
+		variable Variable
+		expected []string
+	}{
+		{"-e {}", Variable{"A", "1", ""}, []string{"-e", "A"}},
+		{"--build-arg {name}={value}", Variable{"A", "two words", ""}, []string{"--build-arg", "A=two words"}},
+		{`--env "{name}={value}"`, Variable{"A", "1", ""}, []string{"--env", "A=1"}},
+		{"'{name}' {{{name}}}", Variable{"A", "1", ""}, []string{"{name}", "{A}"}},
+		{`a\ b "c \"d\" \n" ''`, Variable{"A", "1", ""}, []string{"a b", `c "d" \n`, ""}},
+		{"  -e\t\t{}  ", Variable{"A", "1", ""}, []string{"-e", "A"}},
+		{"--secret {name}={file}", Variable{"A", "1", "/dev/shm/A"}, []string{"--secret", "A=/dev/shm/A"}},
+		{"", Variable{"A", "1", ""}, []string{}},
+	} {
+		tmpl, err := Parse(test.template)
+		if err != nil {
+			t.Errorf("%q: %s", test.template, err)
+			continue
+		}
+
+		if args := tmpl.Expand(test.variable); !reflect.DeepEqual(args, test.expected) {
+			t.Errorf("%q: expected %q but found %q!", test.template, test.expected, args)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, template := range []string{
+		"'unterminated",
+		`"unterminated`,
+		`trailing\`,
+		"{unknown}",
+		"{name",
+		"name}",
+	} {
+		if _, err := Parse(template); err == nil {
+			t.Errorf("expected an error parsing %q!", template)
+		} else if _, ok := err.(TemplateError); !ok {
+			t.Errorf("expected a TemplateError but found %v!", err)
+		}
+	}
+}
+
+func TestExpandAll(t *testing.T) {
+	tmpl, err := Parse("-e {}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{"DB_HOST": "a", "DB_PASSWORD": "b", "API_KEY": "c", "PATH": "d"}
+
+	filter, err := NewFilter("DB_*, API_*", "*PASSWORD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"-e", "API_KEY", "-e", "DB_HOST"}
+	if args := tmpl.ExpandAll(env, nil, filter); !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected %q but found %q!", expected, args)
+	}
+
+	if args := tmpl.ExpandAll(env, nil, nil); len(args) != 8 {
+		t.Errorf("expected every variable without a filter but found %q!", args)
+	}
+
+	if _, err := NewFilter("[", ""); err == nil {
+		t.Error("expected an error for a bad pattern!")
+	}
+}